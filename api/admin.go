@@ -0,0 +1,22 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+)
+
+// AdminHandlerFunc only allows requests authenticated with the configured
+// admin token.
+func (api *api) AdminHandlerFunc(h ContextFunc) http.HandlerFunc {
+	return api.ContextHandlerFunc(func(ctx *Context) error {
+		if api.config.Admin.Token == "" {
+			return ErrNotAuthorized
+		} else if token, ok := ctx.token(); !ok {
+			return ErrNotAuthorized
+		} else if subtle.ConstantTimeCompare([]byte(token), []byte(api.config.Admin.Token)) != 1 {
+			return ErrNotAuthorized
+		}
+
+		return h(ctx)
+	})
+}
@@ -0,0 +1,332 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	models "github.com/dutchcoders/slackarchive/models"
+	utils "github.com/dutchcoders/slackarchive/utils"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// AlertPayload is posted to the webhook of a saved search when new
+// messages match its query.
+type AlertPayload struct {
+	Search   models.SavedSearch `json:"search"`
+	Messages []MessageResponse  `json:"messages"`
+}
+
+// alerter matches the messages of every indexed batch against the saved
+// searches.
+func (api *api) alerter() {
+	for ids := range api.alertChan {
+		if err := api.matchSearches(ids); err != nil {
+			log.Errorf("Error matching saved searches: %s", err.Error())
+		}
+	}
+}
+
+// matchSearches searches the messages with ids for every saved search, and
+// alerts the messages that have not been alerted before.
+func (api *api) matchSearches(ids []string) error {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	searches := []models.SavedSearch{}
+	if err := db.Searches.Find(bson.M{
+		"disabled": bson.M{"$ne": true},
+	}).All(&searches); err != nil {
+		return err
+	} else if len(searches) == 0 {
+		return nil
+	}
+
+	// the batch has just been indexed, make sure it can be found
+	if err := api.es.Refresh(context.Background(), messagesIndex); err != nil {
+		return err
+	}
+
+	channels := map[string][]interface{}{}
+
+	for _, search := range searches {
+		sq, err := parseQuery(search.Query)
+		if err != nil {
+			log.Errorf("Error parsing saved search %s: %s", search.ID, err.Error())
+			continue
+		}
+
+		q, err := sq.compile(db, search.Team)
+		if err != nil {
+			log.Errorf("Error compiling saved search %s: %s", search.ID, err.Error())
+			continue
+		}
+
+		if _, ok := channels[search.Team]; !ok {
+			if channels[search.Team], err = visibleChannels(db, search.Team, ""); err != nil {
+				return err
+			}
+		}
+
+		qs := elastic.NewBoolQuery().
+			Must(q).
+			Filter(
+				elastic.NewIdsQuery().Ids(ids...),
+				messagesFilter(search.Team),
+				elastic.NewTermsQuery("channel.raw", channels[search.Team]...),
+			)
+
+		ss := elastic.NewSearchSource().
+			Query(qs).
+			Sort("ts.float", true).
+			Size(len(ids))
+
+		searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+		if err != nil {
+			log.Errorf("Error matching saved search %s: %s", search.ID, err.Error())
+			continue
+		}
+
+		matched, messages := []string{}, []MessageResponse{}
+		for _, hit := range searchResult.Hits.Hits {
+			// edited messages are indexed again
+			if count, err := db.Alerts.Find(bson.M{
+				"search":   search.ID,
+				"messages": hit.Id,
+			}).Count(); err != nil {
+				return err
+			} else if count > 0 {
+				continue
+			}
+
+			msg, err := messageFromHit(hit)
+			if err != nil {
+				continue
+			}
+
+			matched = append(matched, hit.Id)
+			messages = append(messages, *msg)
+		}
+
+		if len(messages) == 0 {
+			continue
+		}
+
+		if err := api.alert(db, &search, matched, messages); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// alert delivers the messages with ids for search, unless the rate limit of the search
+// has been reached, and records the result.
+func (api *api) alert(db *database, search *models.SavedSearch, ids []string, messages []MessageResponse) error {
+	now := time.Now()
+
+	alert := models.Alert{
+		ID:        utils.NewUUID().String(),
+		Search:    search.ID,
+		Team:      search.Team,
+		User:      search.User,
+		Messages:  ids,
+		CreatedAt: now,
+	}
+
+	count, err := db.Alerts.Find(bson.M{
+		"search": search.ID,
+		"status": models.AlertDelivered,
+		"created_at": bson.M{
+			"$gt": now.Add(-api.config.Alerts.Window),
+		},
+	}).Count()
+	if err != nil {
+		return err
+	}
+
+	if count >= api.config.Alerts.Limit {
+		alert.Status = models.AlertRateLimited
+	} else if err := api.deliver(db, search, messages); err != nil {
+		log.Errorf("Error delivering alert for saved search %s: %s", search.ID, err.Error())
+
+		alert.Status = models.AlertFailed
+		alert.Error = err.Error()
+	} else {
+		alert.Status = models.AlertDelivered
+	}
+
+	log.Infof("Alert for saved search %s with %d messages: %s", search.ID, len(messages), alert.Status)
+
+	return db.Alerts.Insert(&alert)
+}
+
+func (api *api) deliver(db *database, search *models.SavedSearch, messages []MessageResponse) error {
+	if search.Webhook != "" {
+		if err := postWebhook(search, messages); err != nil {
+			return err
+		}
+	}
+
+	if search.Email != "" {
+		if err := api.sendMail(db, search, messages); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// errWebhookAddress is returned when a webhook resolves to an address that
+// isn't public.
+var errWebhookAddress = fmt.Errorf("Webhook should not resolve to a loopback, link-local or private address")
+
+// publicAddress returns true if ip can be reached by webhooks, which should
+// not be used to reach the services on the host or in its network.
+func publicAddress(ip net.IP) bool {
+	return !(ip.IsLoopback() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() ||
+		ip.IsPrivate() ||
+		ip.IsUnspecified() ||
+		ip.IsMulticast())
+}
+
+// checkWebhook returns an error if webhook isn't a http or https url, or
+// its host resolves to an address that isn't public.
+func checkWebhook(ctx context.Context, webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("Webhook should be a http or https url")
+	}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("Webhook host could not be resolved")
+	}
+
+	for _, addr := range addrs {
+		if !publicAddress(addr.IP) {
+			return errWebhookAddress
+		}
+	}
+
+	return nil
+}
+
+// webhookClient checks the address of every connection, after the host has
+// been resolved, so the host can't resolve to another address than it did
+// when the webhook was saved. Proxies are not used, the address of the
+// proxy would be checked instead.
+var webhookClient = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+
+				if ip := net.ParseIP(host); ip == nil || !publicAddress(ip) {
+					return errWebhookAddress
+				}
+
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout: 10 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 3 {
+			return fmt.Errorf("Webhook redirected too many times")
+		}
+
+		return nil
+	},
+}
+
+func postWebhook(search *models.SavedSearch, messages []MessageResponse) error {
+	data, err := json.Marshal(AlertPayload{
+		Search:   *search,
+		Messages: messages,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := webhookClient.Post(search.Webhook, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook returned %s", resp.Status)
+	}
+
+	return nil
+}
+
+// newlineReplacer replaces line breaks, which would end a mail header.
+var newlineReplacer = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
+// mailSubject returns subject on a single line, encoded as mime encoded-word
+// if it isn't plain ascii.
+func mailSubject(subject string) string {
+	return mime.QEncoding.Encode("utf-8", newlineReplacer.Replace(subject))
+}
+
+func (api *api) sendMail(db *database, search *models.SavedSearch, messages []MessageResponse) error {
+	conf := api.config.Alerts.SMTP
+	if conf.Host == "" {
+		return fmt.Errorf("Email has not been configured")
+	}
+
+	body := bytes.Buffer{}
+	fmt.Fprintf(&body, "From: %s\r\n", conf.From)
+	fmt.Fprintf(&body, "To: %s\r\n", search.Email)
+	fmt.Fprintf(&body, "Subject: %s\r\n", mailSubject(fmt.Sprintf("%d new messages for %s", len(messages), search.Name)))
+	fmt.Fprintf(&body, "Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&body, "New messages match your saved search %s (%s).\r\n\r\n", search.Name, search.Query)
+
+	for _, message := range messages {
+		channel, user := message.Channel, message.User
+
+		if c := (models.Channel{}); db.Channels.FindId(channel).One(&c) == nil {
+			channel = c.Name
+		}
+
+		if u := (models.User{}); db.Users.FindId(user).One(&u) == nil {
+			user = u.Name
+		}
+
+		t := (&models.Message{Timestamp: message.Timestamp}).Time()
+
+		fmt.Fprintf(&body, "#%s %s @%s:\r\n%s\r\n\r\n", channel, t.UTC().Format(time.RFC822), user, message.Text)
+	}
+
+	var auth smtp.Auth
+	if conf.Username != "" {
+		auth = smtp.PlainAuth("", conf.Username, conf.Password, conf.Host)
+	}
+
+	return smtp.SendMail(fmt.Sprintf("%s:%d", conf.Host, conf.Port), auth, conf.From, []string{search.Email}, body.Bytes())
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		ip       string
+		expected bool
+	}{
+		{"127.0.0.1", false},
+		{"127.1.2.3", false},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"224.0.0.1", false},
+		{"::1", false},
+		{"::", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"ff02::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"8.8.8.8", true},
+		{"172.32.0.1", true},
+		{"2001:4860:4860::8888", true},
+		{"::ffff:8.8.8.8", true},
+	}
+
+	for _, test := range tests {
+		if actual := publicAddress(net.ParseIP(test.ip)); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.ip, test.expected, actual)
+		}
+	}
+}
+
+func TestCheckWebhook(t *testing.T) {
+	tests := []struct {
+		webhook string
+		err     bool
+	}{
+		{"https://8.8.8.8/hook", false},
+		{"http://[2001:4860:4860::8888]:8080/hook", false},
+		{"http://127.0.0.1/hook", true},
+		{"http://localhost:8080/hook", true},
+		{"http://10.0.0.1/hook", true},
+		{"http://192.168.1.1/hook", true},
+		{"http://169.254.169.254/latest/meta-data/", true},
+		{"http://[::1]/hook", true},
+		{"http://[::ffff:127.0.0.1]/hook", true},
+		{"http://[::ffff:10.0.0.1]/hook", true},
+		{"ftp://8.8.8.8/hook", true},
+		{"https:///hook", true},
+		{"not a url", true},
+	}
+
+	for _, test := range tests {
+		err := checkWebhook(context.Background(), test.webhook)
+		if test.err && err == nil {
+			t.Errorf("%s: expected error", test.webhook)
+		} else if !test.err && err != nil {
+			t.Errorf("%s: unexpected error %s", test.webhook, err.Error())
+		}
+	}
+}
+
+func TestWebhookClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// the server listens on a loopback address, which webhooks can't reach
+	resp, err := webhookClient.Get(server.URL)
+	if err == nil {
+		resp.Body.Close()
+		t.Errorf("%s: expected error", server.URL)
+	} else if !strings.Contains(err.Error(), errWebhookAddress.Error()) {
+		t.Errorf("%s: expected %q, got %q", server.URL, errWebhookAddress.Error(), err.Error())
+	}
+}
@@ -12,7 +12,6 @@ import (
 	"os"
 	"os/signal"
 	"path"
-	"regexp"
 	"strconv"
 	"sync"
 	"time"
@@ -29,6 +28,7 @@ import (
 	utils "github.com/dutchcoders/slackarchive/utils"
 
 	handlers "github.com/dutchcoders/slackarchive/api/handlers"
+	search "github.com/dutchcoders/slackarchive/search"
 
 	elastic "gopkg.in/olivere/elastic.v5"
 
@@ -44,16 +44,24 @@ import (
 
 var log = logging.MustGetLogger("slackarchive-api")
 
+// messagesIndex is the search index containing all messages.
+const messagesIndex = "slackarchive"
+
 type api struct {
 	session *mgo.Session
-	es      *elastic.Client
+	es      search.Backend
 	config  *config.Config
 	store   *sessions.CookieStore
+	keyring *keyring
 
 	wg sync.WaitGroup
 
 	indexChan chan (Message)
 
+	// alertChan receives the ids of indexed messages, to be matched
+	// against saved searches
+	alertChan chan []string
+
 	// Registered connections.
 	connections map[*connection]bool
 
@@ -62,6 +70,10 @@ type api struct {
 
 	// Unregister requests from connections.
 	unregister chan *connection
+
+	stats statsCache
+
+	settings settingsCache
 }
 
 func New(config *config.Config) *api {
@@ -72,7 +84,12 @@ func New(config *config.Config) *api {
 
 	session.SetMode(mgo.Monotonic, true)
 
-	es, err := elastic.NewClient(elastic.SetURL(config.ElasticSearch.URL), elastic.SetSniff(true))
+	es, err := search.New(config.ElasticSearch.Backend, config.ElasticSearch.URL)
+	if err != nil {
+		panic(err)
+	}
+
+	keyring, err := newKeyring(config)
 	if err != nil {
 		panic(err)
 	}
@@ -87,7 +104,9 @@ func New(config *config.Config) *api {
 		es:          es,
 		config:      config,
 		store:       store,
+		keyring:     keyring,
 		indexChan:   make(chan Message),
+		alertChan:   make(chan []string, 100),
 		connections: map[*connection]bool{},
 		register:    make(chan *connection),
 		unregister:  make(chan *connection),
@@ -102,16 +121,27 @@ func (api *api) indexer() {
 
 	start := time.Now()
 
+	ids := []string{}
+
 	flush := func() {
-		if response, err := bulk.Do(context.Background()); err != nil {
+		indexed, err := bulk.Do(context.Background())
+		if err != nil {
 			log.Error("Error indexing: ", err.Error())
-		} else {
-			indexed := response.Indexed()
-			count += len(indexed)
+			return
+		}
+
+		count += indexed
+
+		rate := float64(count) / time.Now().Sub(start).Minutes()
+		log.Infof("Bulk indexing: %d total %d (%f messages per minute).", indexed, count, rate)
 
-			rate := float64(count) / time.Now().Sub(start).Minutes()
-			log.Infof("Bulk indexing: %d total %d (%f messages per minute).", len(indexed), rate, count)
+		select {
+		case api.alertChan <- ids:
+		default:
+			log.Errorf("Alerts are falling behind, skipped matching %d messages.", len(ids))
 		}
+
+		ids = []string{}
 	}
 
 	api.wg.Add(1)
@@ -138,22 +168,46 @@ func (api *api) indexer() {
 
 				db := Database(session)
 
-				if _, err := db.Messages.UpsertId(message.ID, &message); err != nil {
+				if err := api.preserve(db, &message); err != nil {
+					log.Errorf("Error preserving held message: %s", err.Error())
+				}
+
+				if stored, err := api.encrypt(&message); err != nil {
+					log.Errorf("Error encrypting message: %s", err.Error())
+				} else if _, err := db.Messages.UpsertId(message.ID, stored); err != nil {
 					log.Error("Error upserting: %s", err.Error())
 				}
 
+				doc, err := api.document(db, &message)
+
 				session.Close()
 
-				bulk = bulk.Add(elastic.NewBulkIndexRequest().
-					Index("slackarchive").
-					Type("message").
-					Id(message.ID).
-					Doc(message),
-				)
+				if err != nil {
+					log.Errorf("Error creating document: %s", err.Error())
+					continue
+				}
+
+				bulk.Index(messagesIndex, message.ID, doc)
+				ids = append(ids, message.ID)
 
 				if bulk.NumberOfActions() < 100 {
 					continue
 				}
+			} else if msg.Category == "usergroup" {
+				group := models.UserGroup{}
+				if err := json.Unmarshal(msg.Body, &group); err != nil {
+					log.Errorf("Error unmarshaling user group: %s\n%s", err.Error(), string(msg.Body))
+					continue
+				}
+
+				session := api.session.Copy()
+
+				if err := saveUserGroup(Database(session), &group); err != nil {
+					log.Errorf("Error upserting user group: %s", err.Error())
+				}
+
+				session.Close()
+				continue
 			}
 
 		case <-time.After(time.Second * 10):
@@ -273,6 +327,7 @@ func (api *api) usersHandler(ctx *Context) error {
 	response := struct {
 		Users      []UserResponse `json:"users"`
 		TotalCount int64          `json:"total"`
+		NextCursor string         `json:"next_cursor,omitempty"`
 	}{}
 
 	var team *models.Team
@@ -285,22 +340,33 @@ func (api *api) usersHandler(ctx *Context) error {
 	team_id := team.ID
 
 	offset := int(0)
-	if val, err := strconv.Atoi(ctx.r.FormValue("offset")); err == nil {
+	if val, err := strconv.Atoi(ctx.r.FormValue("offset")); err == nil && val >= 0 {
 		offset = val
 	}
 
-	size := int(1000)
-	if val, err := strconv.Atoi(ctx.r.FormValue("size")); err == nil {
-		size = val
+	size, err := pageSize(ctx, 1000, 1000)
+	if err != nil {
+		return err
 	}
 
-	qry := ctx.db.Users.Find(bson.M{"team": team_id})
+	qry := bson.M{"team": team_id}
 
-	if count, err := qry.Count(); err != nil {
+	if count, err := ctx.db.Users.Find(qry).Count(); err == nil {
 		response.TotalCount = int64(count)
 	}
 
-	iter := qry.Skip(offset).Limit(size).Iter()
+	cursor := ctx.r.FormValue("cursor")
+	if cursor != "" {
+		id, err := decodeKeyCursor(cursor)
+		if err != nil {
+			return err
+		}
+
+		qry["_id"] = bson.M{"$gt": id}
+		offset = 0
+	}
+
+	iter := ctx.db.Users.Find(qry).Sort("_id").Skip(offset).Limit(size).Iter()
 	defer iter.Close()
 
 	user := models.User{}
@@ -313,6 +379,14 @@ func (api *api) usersHandler(ctx *Context) error {
 		response.Users = append(response.Users, usr)
 	}
 
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	if len(response.Users) == size {
+		response.NextCursor = encodeCursor(user.ID)
+	}
+
 	return ctx.Write(response)
 }
 
@@ -336,6 +410,7 @@ func (api *api) channelsHandler(ctx *Context) error {
 	response := struct {
 		Channels   []ChannelResponse `json:"channels"`
 		TotalCount int64             `json:"total"`
+		NextCursor string            `json:"next_cursor,omitempty"`
 	}{}
 
 	var team *models.Team
@@ -348,30 +423,38 @@ func (api *api) channelsHandler(ctx *Context) error {
 	team_id := team.ID
 
 	offset := int(0)
-	if val, err := strconv.Atoi(ctx.r.FormValue("offset")); err == nil {
+	if val, err := strconv.Atoi(ctx.r.FormValue("offset")); err == nil && val >= 0 {
 		offset = val
 	}
 
-	size := int(100)
-	if val, err := strconv.Atoi(ctx.r.FormValue("size")); err == nil {
-		size = val
+	size, err := pageSize(ctx, 100, 1000)
+	if err != nil {
+		return err
 	}
 
-	qry := ctx.db.Channels.Find(
-		bson.M{
-			"$and": []bson.M{
-				bson.M{"team": team_id},
-				bson.M{"is_member": true},
-			},
-		})
+	qry := bson.M{
+		"team":      team_id,
+		"is_member": true,
+	}
 
-	if count, err := qry.Count(); err != nil {
+	if count, err := ctx.db.Channels.Find(qry).Count(); err != nil {
 		fmt.Printf("Error: %#v\n", err.Error())
 	} else {
 		response.TotalCount = int64(count)
 	}
 
-	iter := qry.
+	if cursor := ctx.r.FormValue("cursor"); cursor != "" {
+		id, err := decodeKeyCursor(cursor)
+		if err != nil {
+			return err
+		}
+
+		qry["_id"] = bson.M{"$gt": id}
+		offset = 0
+	}
+
+	iter := ctx.db.Channels.Find(qry).
+		Sort("_id").
 		Skip(offset).
 		Limit(size).
 		Iter()
@@ -390,6 +473,10 @@ func (api *api) channelsHandler(ctx *Context) error {
 		response.Channels = append(response.Channels, chnl)
 	}
 
+	if len(channels) == size {
+		response.NextCursor = encodeCursor(channels[len(channels)-1].ID)
+	}
+
 	return ctx.Write(response)
 }
 
@@ -511,80 +598,24 @@ func (api *api) Team(ctx *Context) (*models.Team, error) {
 }
 
 func (api *api) messagesHandler(ctx *Context) error {
-	type MessageResponse struct {
-		Text            string `json:"text"`
-		Channel         string `json:"channel"`
-		User            string `json:"user"`
-		Type            string `json:"type"`
-		Timestamp       string `json:"ts"`
-		ThreadTimestamp string `json:"thread_ts,omitempty"`
-
-		IsStarred   bool         `json:"is_starred,omitempty"`
-		PinnedTo    []string     `json:"pinned_to,omitempty"`
-		Attachments []Attachment `json:"attachments,omitempty"`
-		// Edited      *Edited      `json:"edited,omitempty"`
-
-		// Message Subtypes
-		SubType string `json:"subtype,omitempty"`
-
-		// Hidden Subtypes
-		Hidden           bool   `json:"hidden,omitempty"`     // message_changed, message_deleted, unpinned_item
-		DeletedTimestamp string `json:"deleted_ts,omitempty"` // message_deleted
-		EventTimestamp   string `json:"event_ts,omitempty"`
-
-		// bot_message (https://api.slack.com/events/message/bot_message)
-		BotID    string `json:"bot_id,omitempty"`
-		Username string `json:"username,omitempty"`
-
-		Icons struct {
-			IconURL   string `json:"icon_url,omitempty"`
-			IconEmoji string `json:"icon_emoji,omitempty"`
-		} `json:"icons,omitempty"`
-
-		// channel_join, group_join
-		Inviter string `json:"inviter,omitempty"`
-
-		// channel_topic, group_topic
-		Topic string `json:"topic,omitempty"`
-
-		// channel_purpose, group_purpose
-		Purpose string `json:"purpose,omitempty"`
-
-		// channel_name, group_name
-		Name    string `json:"name,omitempty"`
-		OldName string `json:"old_name,omitempty"`
-
-		// channel_archive, group_archive
-		Members []string `json:"members,omitempty"`
-
-		// file_share, file_comment, file_mention
-		// File *File `json:"file,omitempty"`
-
-		// file_share
-		Upload bool `json:"upload,omitempty"`
-
-		// file_comment
-		// Comment *Comment `json:"comment,omitempty"`
-
-		// pinned_item
-		ItemType string `json:"item_type,omitempty"`
-
-		// https://api.slack.com/rtm
-		ReplyTo int    `json:"reply_to,omitempty"`
-		Team    string `json:"team,omitempty"`
-	}
-
 	response := struct {
 		Messages   []MessageResponse `json:"messages"`
 		TotalCount int64             `json:"total"`
-		Aggs       struct {
+		NextCursor string            `json:"next_cursor,omitempty"`
+
+		// Fuzzy is set when the messages match the free text fuzzily
+		Fuzzy       bool         `json:"fuzzy,omitempty"`
+		Suggestions []Suggestion `json:"suggestions"`
+
+		Aggs struct {
 			Buckets map[string]int64 `json:"buckets"`
 		} `json:"aggs"`
 		Related struct {
 			Users map[string]UserResponse `json:"users"`
 		} `json:"related"`
 	}{
-		Messages: []MessageResponse{},
+		Messages:    []MessageResponse{},
+		Suggestions: []Suggestion{},
 		Aggs: struct {
 			Buckets map[string]int64 `json:"buckets"`
 		}{
@@ -606,174 +637,152 @@ func (api *api) messagesHandler(ctx *Context) error {
 		return err
 	}
 
-	qs := elastic.NewBoolQuery()
+	// fuzzy=1 always matches fuzzily, e.g. for the next pages of a fuzzy
+	// search, fuzzy=0 never falls back to fuzzy matching
+	fuzzy := ctx.r.FormValue("fuzzy") == "1"
 
-	qs = qs.Must(elastic.NewMatchAllQuery())
-	if val := ctx.r.FormValue("q"); val != "" {
-		qs = qs.Must(elastic.NewQueryStringQuery(val).DefaultOperator("AND"))
+	sq, qs, pf, err := api.messagesQuery(ctx, team, fuzzy)
+	if err != nil {
+		return err
 	}
 
-	var pf = elastic.NewBoolQuery()
-
-	var fq = elastic.NewBoolQuery()
-
-	fq = fq.Must(elastic.NewTermsQuery("team.raw", team.ID))
+	sortOrder := false
+	if val := ctx.r.FormValue("sort"); val == "asc" {
+		sortOrder = true
+	}
 
-	channels := []models.Channel{}
+	offset := int(0)
+	if val, err := strconv.Atoi(ctx.r.FormValue("offset")); err == nil && val >= 0 {
+		offset = val
+	}
 
-	// check if bot have been removed from the channel
-	if channel := ctx.r.FormValue("channel"); channel != "" {
-		//pf = pf.Must(elastic.NewTermQuery("Channel.raw", channel))
-		if err := ctx.db.Channels.Find(
-			bson.M{
-				"$and": []bson.M{
-					bson.M{"_id": channel},
-					bson.M{"team": team.ID},
-					bson.M{"is_member": true},
-				},
-			}).All(&channels); err != nil {
-			return err
-		}
-	} else {
-		// only channels where the bot is still archiving
-		if err := ctx.db.Channels.Find(
-			bson.M{
-				"$and": []bson.M{
-					bson.M{"team": team.ID},
-					bson.M{"is_member": true},
-				},
-			}).All(&channels); err != nil {
-			return err
-		}
+	size, err := pageSize(ctx, 100, 500)
+	if err != nil {
+		return err
+	} else if offset+size > maxResultWindow {
+		return ErrResultWindowExceeded
 	}
 
-	channelsStr := []interface{}{}
-	for _, channel := range channels {
-		channelsStr = append(channelsStr, channel.ID)
+	relevance := ctx.r.FormValue("sort") == "relevance"
+
+	sorters := 2
+	if relevance {
+		sorters++
 	}
 
-	pf = pf.Must(elastic.NewTermsQuery("channel.raw", channelsStr...))
+	cursor := ctx.r.FormValue("cursor")
 
-	if val := ctx.r.FormValue("qfrom"); val == "" {
-	} else if qfrom, err := strconv.ParseFloat(ctx.r.FormValue("qfrom"), 64); err != nil {
-	} else if val := ctx.r.FormValue("qto"); val == "" {
-	} else if qto, err := strconv.ParseFloat(ctx.r.FormValue("qto"), 64); err != nil {
+	var after []interface{}
+	if cursor == "" {
+	} else if values, err := decodeCursor(cursor, sorters); err != nil {
+		return err
 	} else {
-		log.Info("Using qfrom and qto")
-		qs = qs.Must(elastic.NewRangeQuery("ts.float").Gte(qfrom).Lt(qto))
+		after = values
 	}
 
-	// TODO: check if channel is public
-	/*
-		if count, err := ctx.db.Teams.Find(bson.M{
-			"is_disabled": bson.M{
-				"$not": bson.M{"$eq": true},
-			},
-			"_id": team_id,
-		}).Count(); err != nil {
-			fmt.Printf("Error: %#v\n", err.Error())
+	var suggester elastic.Suggester
+	if len(sq.Text) > 0 && !sq.Fuzzy && !sq.Code {
+		channels, err := visibleChannels(ctx.db, team.ID, "")
+		if err != nil {
 			return err
-		} else if count == 0 {
-			return fmt.Errorf("Team is disabled or does not exist")
 		}
-	*/
 
-	if val := ctx.r.FormValue("thread"); val == "" {
-	} else if val, err := strconv.ParseFloat(val, 64); err != nil {
-	} else {
-		fq = fq.Must(elastic.NewTermQuery("thread_ts.float", val))
+		suggester = sq.suggester(team.ID, channels)
 	}
 
-	from := float64(0)
-	if val, err := strconv.ParseFloat(ctx.r.FormValue("from"), 64); err == nil {
-		from = val
-	}
+	search := func(sq *searchQuery, qs, pf *elastic.BoolQuery, suggester elastic.Suggester) (*elastic.SearchResult, error) {
+		var q elastic.Query = qs
+		if relevance {
+			q = sq.relevance(qs)
+		}
 
-	to := float64(time.Now().Unix())
-	if val, err := strconv.ParseFloat(ctx.r.FormValue("to"), 64); err == nil {
-		to = val
-	}
+		ss := elastic.NewSearchSource().
+			Query(q).
+			PostFilter(pf).
+			Highlight(messagesHighlight())
 
-	sortOrder := false
-	if val := ctx.r.FormValue("sort"); val == "asc" {
-		sortOrder = true
-	}
+		if val := ctx.r.FormValue("aggs"); val == "1" {
+			channelAgg := elastic.NewTermsAggregation().Field("channel.raw").Size(100).OrderByCountDesc()
+			ss = ss.Aggregation("channel", channelAgg)
+		}
 
-	fq = fq.MustNot(elastic.NewTermQuery("sub_type.raw", "message_changed"))
-	fq = fq.MustNot(elastic.NewTermQuery("sub_type.raw", "message_deleted"))
-	fq = fq.MustNot(elastic.NewTermQuery("sub_type.raw", "channel_join"))
-	fq = fq.MustNot(elastic.NewTermQuery("sub_type.raw", "channel_leave"))
-	fq = fq.MustNot(elastic.NewTermQuery("sub_type.raw", "pinned_item"))
-	fq = fq.MustNot(elastic.NewTermQuery("hidden", true))
-	fq = fq.Must(elastic.NewRangeQuery("ts.float").Gte(from).Lt(to))
+		if suggester != nil {
+			ss = ss.Suggester(suggester)
+		}
 
-	qs = qs.Filter(fq)
+		if relevance {
+			ss = ss.Sort("_score", false)
+		}
 
-	offset := int(0)
-	if val, err := strconv.Atoi(ctx.r.FormValue("offset")); err == nil {
-		offset = val
-	}
+		// the id breaks ties between messages posted at the same time, so the
+		// order is stable across pages
+		ss = ss.Sort("ts.float", sortOrder).
+			Sort("id.raw", sortOrder).
+			Size(size)
 
-	size := int(100)
-	if val, err := strconv.Atoi(ctx.r.FormValue("size")); err != nil {
-	} else if size < 500 {
-		size = val
-	}
+		if after == nil {
+			ss = ss.From(offset)
+		} else {
+			ss = ss.SearchAfter(after...)
+		}
 
-	hl := elastic.
-		NewHighlight().
-		PreTags("[hl]").
-		PostTags("[/hl]").
-		RequireFieldMatch(false).
-		NumOfFragments(0).
-		Fields(
-			elastic.NewHighlighterField("text"),
-			elastic.NewHighlighterField("attachments.text"),
-		)
+		func() {
+			src, err := qs.Source()
+			if err != nil {
+				log.Error(err.Error())
+				return
+			}
 
-	ss := api.es.Search().
-		Index("slackarchive").
-		Type("message").
-		Query(qs).
-		PostFilter(pf).
-		Highlight(hl)
+			data, err := json.Marshal(src)
+			if err != nil {
+				log.Error(err.Error())
+				return
+			}
 
-	if val := ctx.r.FormValue("aggs"); val == "1" {
-		channelAgg := elastic.NewTermsAggregation().Field("Channel.raw").Size(100).OrderByCountDesc()
-		ss = ss.Aggregation("channel", channelAgg)
-	}
+			s := string(data)
+			log.Debug(s)
+		}()
 
-	ss = ss.Sort("ts.float", sortOrder).
-		From(offset).
-		Size(size)
+		searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+		if err == nil {
+			return searchResult, nil
+		} else if ee, ok := err.(*elastic.Error); ok {
+			json.NewEncoder(os.Stdout).Encode(ee)
 
-	func() {
-		src, err := qs.Source()
-		if err != nil {
-			log.Error(err.Error())
-			return
-		}
+			log.Error("Error search: %s %s", ee.Details.Type, ee.Details.Reason)
+			log.Error("Error search: %s", ee.Error())
 
-		data, err := json.Marshal(src)
-		if err != nil {
-			log.Error(err.Error())
-			return
+			if ee.Status == http.StatusBadRequest {
+				// the free text part of the query could not be parsed
+				return nil, errInvalidQuery("Invalid query: %s", ee.Details.Reason)
+			}
+
+			return nil, ee
+		} else {
+			return nil, err
 		}
+	}
 
-		s := string(data)
-		log.Debug(s)
-	}()
+	searchResult, err := search(sq, qs, pf, suggester)
+	if err != nil {
+		return err
+	}
 
-	searchResult, err := ss.Do(context.Background())
-	if err == nil {
-	} else if ee, ok := err.(*elastic.Error); ok {
-		json.NewEncoder(os.Stdout).Encode(ee)
+	if suggester != nil {
+		response.Suggestions = sq.suggestions(searchResult)
+	}
 
-		log.Error("Error search: %s %s", ee.Details.Type, ee.Details.Reason)
-		log.Error("Error search: %s", ee.Error())
-		return ee
-	} else {
+	// misspelled terms return few or no hits, retry the first page matching
+	// terms within a small edit distance
+	if len(sq.Text) == 0 || sq.Fuzzy || sq.Code || ctx.r.FormValue("fuzzy") == "0" {
+	} else if searchResult.Hits.TotalHits >= fuzzyThreshold || offset > 0 || cursor != "" {
+	} else if fsq, fqs, fpf, err := api.messagesQuery(ctx, team, true); err != nil {
 		return err
+	} else if fuzzyResult, err := search(fsq, fqs, fpf, nil); err != nil {
+		return err
+	} else if fuzzyResult.Hits.TotalHits > searchResult.Hits.TotalHits {
+		searchResult = fuzzyResult
+		response.Fuzzy = true
 	}
 
 	response.TotalCount = searchResult.Hits.TotalHits
@@ -785,77 +794,24 @@ func (api *api) messagesHandler(ctx *Context) error {
 	}
 
 	for _, hit := range searchResult.Hits.Hits {
-		var message models.Message
-		if err := json.Unmarshal(*hit.Source, &message); err != nil {
+		msg, err := messageFromHit(hit)
+		if err != nil {
 			continue
 		}
 
-		msg := MessageResponse{}
-		if err := utils.Merge(&msg, message); err != nil {
-			log.Error(err.Error())
-		}
-
-		// update highlight output
-		if hit.Highlight != nil {
-			if hl, ok := hit.Highlight["text"]; ok {
-				msg.Text = hl[0]
-			}
-
-			if hl, ok := hit.Highlight["attachments.text"]; ok {
-				for i, _ := range hl {
-					msg.Attachments[i].Text = hl[i]
-				}
-			}
-		}
-
-		response.Messages = append(response.Messages, msg)
+		response.Messages = append(response.Messages, *msg)
 	}
 
-	r := regexp.MustCompile(`\<\@(.+?)\>`)
-
-	userids := []string{}
-	for _, message := range response.Messages {
-		// extract matches from message text
-		func() {
-			var matches [][]string
-			if matches = r.FindAllStringSubmatch(message.Text, -1); matches == nil {
-				return
-			}
-
-			for _, match := range matches {
-				userids = append(userids, match[1])
-			}
-		}()
-
-		if message.User == "" {
-			continue
-		}
-
-		userids = append(userids, message.User)
+	if hits := searchResult.Hits.Hits; len(hits) == size {
+		response.NextCursor = encodeCursor(hits[len(hits)-1].Sort...)
 	}
 
-	iter := ctx.db.Users.Find(
-		bson.M{
-			"_id": bson.M{
-				"$in": userids,
-			},
-		}).Iter()
-
-	defer iter.Close()
-
-	users := []models.User{}
-	if err := iter.All(&users); err != nil {
+	users, err := relatedUsers(ctx.db, response.Messages)
+	if err != nil {
 		return err
 	}
 
-	for _, user := range users {
-		usr := UserResponse{}
-		if err := utils.Merge(&usr, user); err != nil {
-			log.Error(err.Error())
-		}
-
-		response.Related.Users[user.ID] = usr
-	}
+	response.Related.Users = users
 
 	return ctx.Write(response)
 }
@@ -872,7 +828,7 @@ func (api *api) updateIds(ctx *Context) error {
 
 	message := models.Message{}
 	for iter.Next(&message) {
-		newID := fmt.Sprintf("%s-%s-%s", message.Team, message.Channel, message.Timestamp)
+		newID := messageID(message.Team, message.Channel, message.Timestamp)
 		if newID == message.ID {
 			continue
 		}
@@ -894,13 +850,50 @@ func (api *api) updateIds(ctx *Context) error {
 }
 
 func (api *api) reIndex(ctx *Context) error {
-	iter := ctx.db.Messages.Find(nil).Batch(1000).Iter()
+	_, err := api.Reindex()
+	return err
+}
+
+// Reindex indexes all archived messages into elasticsearch.
+func (api *api) Reindex() (int, error) {
+	return api.reindex(nil)
+}
+
+// reindex indexes the archived messages matching qry into elasticsearch.
+func (api *api) reindex(qry bson.M) (int, error) {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	if err := api.EnsureIndex(); err != nil {
+		return 0, err
+	}
+
+	iter := db.Messages.Find(qry).Batch(1000).Iter()
 
 	defer iter.Close()
 
 	bulk := api.es.Bulk()
 
-	count := 0
+	// messages that can't be decrypted or indexed are skipped, and reported
+	// when all others have been indexed
+	count, failed := 0, 0
+
+	flush := func() error {
+		actions := bulk.NumberOfActions()
+
+		indexed, err := bulk.Do(context.Background())
+		if err != nil {
+			return err
+		}
+
+		count += indexed
+		failed += actions - indexed
+
+		log.Infof("Bulk indexing: %d total %d.", indexed, count)
+		return nil
+	}
 
 	message := models.Message{}
 	for iter.Next(&message) {
@@ -908,29 +901,42 @@ func (api *api) reIndex(ctx *Context) error {
 			continue
 		}
 
-		bulk = bulk.Add(elastic.NewBulkIndexRequest().
-			Index("slackarchive").
-			Type("message").
-			Id(message.ID).
-			Doc(message),
-		)
-
-		if bulk.NumberOfActions() < 1000 {
+		if err := api.decrypt(&message); err != nil {
+			log.Error(err.Error())
+			failed++
 			continue
 		}
 
-		response, err := bulk.Do(context.Background())
+		doc, err := api.document(db, &message)
 		if err != nil {
 			log.Error(err.Error())
-		} else {
-			indexed := response.Indexed()
-			count += len(indexed)
+			failed++
+			continue
+		}
+
+		bulk.Index(messagesIndex, message.ID, doc)
+
+		if bulk.NumberOfActions() < 1000 {
+			continue
+		}
 
-			log.Info("Bulk indexing: %d total %d.", len(indexed), count)
+		if err := flush(); err != nil {
+			return count, err
 		}
 	}
 
-	return nil
+	if bulk.NumberOfActions() == 0 {
+	} else if err := flush(); err != nil {
+		return count, err
+	}
+
+	if err := iter.Err(); err != nil {
+		return count, err
+	} else if failed > 0 {
+		return count, fmt.Errorf("Failed to index %d of %d messages", failed, count+failed)
+	}
+
+	return count, nil
 }
 
 func hash(s string) string {
@@ -979,19 +985,60 @@ func (api *api) Serve() {
 	sr := r.PathPrefix("/v1").Subrouter()
 
 	sr.HandleFunc("/messages", api.ContextHandlerFunc(api.messagesHandler)).Methods("GET")
+	sr.HandleFunc("/messages/facets", api.ContextHandlerFunc(api.facetsHandler)).Methods("GET")
+	sr.HandleFunc("/messages/{id}", api.ContextHandlerFunc(api.permalinkHandler)).Methods("GET")
+	sr.HandleFunc("/messages/{id}/context", api.ContextHandlerFunc(api.contextHandler)).Methods("GET")
+	sr.HandleFunc("/messages/{id}/similar", api.ContextHandlerFunc(api.similarMessagesHandler)).Methods("GET")
+	sr.HandleFunc("/mentions", api.ContextHandlerFunc(api.mentionsHandler)).Methods("GET")
+	sr.HandleFunc("/links", api.ContextHandlerFunc(api.linksHandler)).Methods("GET")
 	sr.HandleFunc("/channels", api.ContextHandlerFunc(api.channelsHandler)).Methods("GET")
+	sr.HandleFunc("/channels/{id}", api.ContextHandlerFunc(api.channelHandler)).Methods("GET")
+	sr.HandleFunc("/channels/{channel}/messages/{ts}", api.ContextHandlerFunc(api.permalinkHandler)).Methods("GET")
 	sr.HandleFunc("/users", api.ContextHandlerFunc(api.usersHandler)).Methods("GET")
+	sr.HandleFunc("/users/{id}", api.ContextHandlerFunc(api.userHandler)).Methods("GET")
+	sr.HandleFunc("/users/{id}/messages", api.ContextHandlerFunc(api.userMessagesHandler)).Methods("GET")
+	sr.HandleFunc("/stats", api.ContextHandlerFunc(api.statsHandler)).Methods("GET")
+	sr.HandleFunc("/responsiveness", api.ContextHandlerFunc(api.responsivenessHandler)).Methods("GET")
 	sr.HandleFunc("/team", api.ContextHandlerFunc(api.teamHandler)).Methods("GET")
+	sr.HandleFunc("/autocomplete", api.ContextHandlerFunc(api.autocompleteHandler)).Methods("GET")
 	/*
 		api.HandleFunc("/messages", messagesHandler).Methods("GET")
 		api.HandleFunc("/me", meHandler).Methods("GET")
 	*/
+	sr.HandleFunc("/admin/holds", api.AdminHandlerFunc(api.holdsHandler)).Methods("GET")
+	sr.HandleFunc("/admin/holds", api.AdminHandlerFunc(api.createHoldHandler)).Methods("POST")
+	sr.HandleFunc("/admin/holds/{id}", api.AdminHandlerFunc(api.holdHandler)).Methods("GET")
+	sr.HandleFunc("/admin/holds/{id}/release", api.AdminHandlerFunc(api.releaseHoldHandler)).Methods("POST")
+
+	sr.HandleFunc("/admin/teams/{id}/settings", api.AdminHandlerFunc(api.settingsHandler)).Methods("GET")
+	sr.HandleFunc("/admin/teams/{id}/settings", api.AdminHandlerFunc(api.updateSettingsHandler)).Methods("PUT")
+
+	sr.HandleFunc("/admin/users/{id}/export", api.AdminHandlerFunc(api.exportUserHandler)).Methods("GET")
+	sr.HandleFunc("/admin/users/{id}/erase", api.AdminHandlerFunc(api.eraseUserHandler)).Methods("POST")
+
+	sr.HandleFunc("/searches", api.UserHandlerFunc(api.searchesHandler)).Methods("GET")
+	sr.HandleFunc("/searches", api.UserHandlerFunc(api.createSearchHandler)).Methods("POST")
+	sr.HandleFunc("/searches/{id}", api.UserHandlerFunc(api.searchHandler)).Methods("GET")
+	sr.HandleFunc("/searches/{id}", api.UserHandlerFunc(api.deleteSearchHandler)).Methods("DELETE")
+	sr.HandleFunc("/searches/{id}/alerts", api.UserHandlerFunc(api.alertsHandler)).Methods("GET")
+
 	sr.HandleFunc("/oauth/login", api.ContextHandlerFunc(api.oAuthLoginHandler)).Methods("GET")
 	sr.HandleFunc("/oauth/callback", api.ContextHandlerFunc(api.oAuthCallbackHandler)).Methods("GET")
 
+	if err := api.EnsureIndex(); err != nil {
+		log.Errorf("Error updating index mapping: %s", err.Error())
+	}
+
 	// run websocket server
 	go api.run()
 	go api.indexer()
+	go api.alerter()
+	go api.autocompleter()
+	go api.userGroupSyncer()
+
+	if len(api.config.Retention.Teams) > 0 {
+		go api.retention()
+	}
 
 	r.HandleFunc("/ws", api.serveWs)
 
@@ -0,0 +1,425 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// autocompleteIndex is the search index containing the names of users and
+// channels and the frequent terms of every team.
+const autocompleteIndex = "slackarchive_autocomplete"
+
+const (
+	// termsPeriod is the period of recent messages terms are collected
+	// from, at most termsMessages messages per team.
+	termsPeriod   = 30 * 24 * time.Hour
+	termsMessages = 20000
+
+	// termsSize is the number of terms per team that can be completed.
+	termsSize = 1000
+)
+
+// autocompleteSettings returns the analysis of the autocomplete index, names
+// are indexed as prefixes of their words.
+func autocompleteSettings() map[string]interface{} {
+	return map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"filter": map[string]interface{}{
+				"autocomplete": map[string]interface{}{
+					"type":     "edge_ngram",
+					"min_gram": 1,
+					"max_gram": 20,
+				},
+			},
+			"analyzer": map[string]interface{}{
+				"autocomplete": map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    []string{"lowercase", "asciifolding", "autocomplete"},
+				},
+				"autocomplete_search": map[string]interface{}{
+					"type":      "custom",
+					"tokenizer": "standard",
+					"filter":    []string{"lowercase", "asciifolding"},
+				},
+			},
+		},
+	}
+}
+
+func autocompleteMapping() map[string]interface{} {
+	keyword := map[string]interface{}{
+		"type": "keyword",
+	}
+
+	name := map[string]interface{}{
+		"type":            "text",
+		"analyzer":        "autocomplete",
+		"search_analyzer": "autocomplete_search",
+		"fields": map[string]interface{}{
+			"raw": map[string]interface{}{
+				"type": "keyword",
+			},
+		},
+	}
+
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			"team":      keyword,
+			"kind":      keyword,
+			"id":        keyword,
+			"name":      name,
+			"real_name": name,
+			"weight": map[string]interface{}{
+				"type": "long",
+			},
+			"generation": map[string]interface{}{
+				"type": "long",
+			},
+		},
+	}
+}
+
+// Completion is a user, channel or term matching an autocomplete prefix.
+// Weight is the number of members of a channel, or the number of recent
+// messages containing a term.
+type Completion struct {
+	Kind     string `json:"kind"`
+	ID       string `json:"id,omitempty"`
+	Name     string `json:"name"`
+	RealName string `json:"real_name,omitempty"`
+	Weight   int64  `json:"weight,omitempty"`
+}
+
+// document returns the id and document of c, generation identifies the
+// synchronization that indexed it.
+func (c Completion) document(team string, generation int64) (string, map[string]interface{}) {
+	key := c.ID
+	if key == "" {
+		key = c.Name
+	}
+
+	return fmt.Sprintf("%s:%s:%s", team, c.Kind, key), map[string]interface{}{
+		"team":       team,
+		"kind":       c.Kind,
+		"id":         c.ID,
+		"name":       c.Name,
+		"real_name":  c.RealName,
+		"weight":     c.Weight,
+		"generation": generation,
+	}
+}
+
+func (api *api) autocompleter() {
+	ticker := time.NewTicker(api.config.Autocomplete.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.syncAutocomplete(); err != nil {
+			log.Errorf("Error updating autocomplete index: %s", err.Error())
+		}
+
+		<-ticker.C
+	}
+}
+
+// syncAutocomplete indexes the users, channels and frequent terms of all
+// teams, and deletes the documents of previous synchronizations that haven't
+// been indexed again, like those of erased users and disabled teams.
+func (api *api) syncAutocomplete() error {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	teams := []models.Team{}
+	if err := db.Teams.Find(bson.M{
+		"is_disabled": bson.M{
+			"$not": bson.M{"$eq": true},
+		},
+	}).All(&teams); err != nil {
+		return err
+	}
+
+	generation := time.Now().UnixNano()
+
+	bulk := api.es.Bulk()
+
+	flush := func() error {
+		if bulk.NumberOfActions() == 0 {
+			return nil
+		}
+
+		// documents that failed to index keep their previous generation and
+		// would be deleted below
+		actions := bulk.NumberOfActions()
+		if n, err := bulk.Do(context.Background()); err != nil {
+			return err
+		} else if n < actions {
+			return fmt.Errorf("Indexed %d of %d autocomplete documents", n, actions)
+		}
+
+		return nil
+	}
+
+	for _, team := range teams {
+		completions, err := api.completions(db, team.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, completion := range completions {
+			id, doc := completion.document(team.ID, generation)
+			bulk.Index(autocompleteIndex, id, doc)
+
+			if bulk.NumberOfActions() < 1000 {
+				continue
+			}
+
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return err
+	}
+
+	if err := api.es.Refresh(context.Background(), autocompleteIndex); err != nil {
+		return err
+	}
+
+	// documents without generation are indexed before generations were
+	// introduced
+	_, err := api.es.DeleteByQuery(context.Background(), autocompleteIndex, elastic.NewBoolQuery().
+		MustNot(elastic.NewRangeQuery("generation").Gte(generation)))
+	return err
+}
+
+// completions returns the active users, the archived channels and the
+// frequent terms in recent messages of those channels of team.
+func (api *api) completions(db *database, team string) ([]Completion, error) {
+	completions := []Completion{}
+
+	users := []models.User{}
+	if err := db.Users.Find(bson.M{
+		"team":    team,
+		"deleted": bson.M{"$ne": true},
+	}).All(&users); err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		completions = append(completions, Completion{
+			Kind:     "user",
+			ID:       user.ID,
+			Name:     user.Name,
+			RealName: user.Profile.RealName,
+		})
+	}
+
+	channels := []models.Channel{}
+	if err := db.Channels.Find(bson.M{
+		"team":      team,
+		"is_member": true,
+	}).All(&channels); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, channel := range channels {
+		completions = append(completions, Completion{
+			Kind:   "channel",
+			ID:     channel.ID,
+			Name:   channel.Name,
+			Weight: int64(channel.NumMembers),
+		})
+
+		ids = append(ids, channel.ID)
+	}
+
+	terms, err := api.frequentTerms(db, team, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(completions, terms...), nil
+}
+
+// frequentTerms returns the terms used in most recent messages of channels,
+// leaving out stopwords, numbers and mentions.
+func (api *api) frequentTerms(db *database, team string, channels []string) ([]Completion, error) {
+	since := time.Now().Add(-termsPeriod)
+
+	iter := db.Messages.Find(bson.M{
+		"team":    team,
+		"channel": bson.M{"$in": channels},
+		"ts":      bson.M{"$gte": strconv.FormatInt(since.Unix(), 10)},
+	}).Sort("-ts").Limit(termsMessages).Batch(1000).Iter()
+	defer iter.Close()
+
+	counts := map[string]int64{}
+
+	message := models.Message{}
+	for iter.Next(&message) {
+		if message.IsDeleted || message.Hidden {
+			continue
+		}
+
+		if err := api.decrypt(&message); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+
+		text := markupRe.ReplaceAllString(message.Text, " ")
+
+		seen := map[string]bool{}
+		for _, term := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if seen[term] || !isTerm(term) {
+				continue
+			}
+
+			seen[term] = true
+			counts[term]++
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	terms := []Completion{}
+	for term, count := range counts {
+		if count < 2 {
+			continue
+		}
+
+		terms = append(terms, Completion{
+			Kind:   "term",
+			Name:   term,
+			Weight: count,
+		})
+	}
+
+	sort.Slice(terms, func(i, j int) bool {
+		return terms[i].Weight > terms[j].Weight
+	})
+
+	if len(terms) > termsSize {
+		terms = terms[:termsSize]
+	}
+
+	return terms, nil
+}
+
+// markupRe matches the mentions and links in a message, which are enclosed
+// in angle brackets.
+var markupRe = regexp.MustCompile(`<[^>]*>`)
+
+func isTerm(term string) bool {
+	if n := len([]rune(term)); n < 3 || n > 30 {
+		return false
+	} else if len(stopwordLanguages[term]) > 0 {
+		return false
+	}
+
+	for _, r := range term {
+		if !unicode.IsDigit(r) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (api *api) autocompleteHandler(ctx *Context) error {
+	var team *models.Team
+	if t, err := api.Team(ctx); err == nil {
+		team = t
+	} else {
+		return err
+	}
+
+	prefix := strings.TrimSpace(ctx.r.FormValue("prefix"))
+	kind := ctx.r.FormValue("kind")
+
+	verr := &errors.ValidationError{}
+	if prefix == "" {
+		verr.Add("prefix", "required", "Prefix is required")
+	}
+
+	switch kind {
+	case "", "user", "channel", "term":
+	default:
+		verr.Add("kind", "invalid", "Kind should be user, channel or term")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	size, err := pageSize(ctx, 10, 50)
+	if err != nil {
+		return err
+	}
+
+	// the sigils of the search modifiers are not part of names
+	prefix = strings.TrimLeft(prefix, "@#")
+
+	fq := elastic.NewBoolQuery().
+		Filter(elastic.NewTermQuery("team", team.ID))
+
+	if kind != "" {
+		fq = fq.Filter(elastic.NewTermQuery("kind", kind))
+	}
+
+	q := fq.
+		Must(elastic.NewMultiMatchQuery(prefix, "name", "real_name").Operator("and")).
+		Should(elastic.NewTermQuery("name.raw", strings.ToLower(prefix)).Boost(2))
+
+	ss := elastic.NewSearchSource().
+		Query(q).
+		Sort("_score", false).
+		Sort("weight", false).
+		Size(size)
+
+	searchResult, err := api.es.Search(context.Background(), autocompleteIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	response := struct {
+		Completions []Completion `json:"completions"`
+	}{
+		Completions: []Completion{},
+	}
+
+	for _, hit := range searchResult.Hits.Hits {
+		completion := Completion{}
+		if err := json.Unmarshal(*hit.Source, &completion); err != nil {
+			log.Error(err.Error())
+			continue
+		}
+
+		response.Completions = append(response.Completions, completion)
+	}
+
+	return ctx.Write(response)
+}
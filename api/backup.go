@@ -0,0 +1,367 @@
+package api
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const backupVersion = 1
+
+// BackupManifest describes the contents of a backup archive.
+type BackupManifest struct {
+	Version     int                `json:"version"`
+	Created     time.Time          `json:"created"`
+	Collections []BackupCollection `json:"collections"`
+}
+
+// BackupCollection describes a single collection within a backup archive,
+// stored as one extended json document per line.
+type BackupCollection struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Count  int    `json:"count"`
+	SHA256 string `json:"sha256"`
+}
+
+// collections returns the collections contained in a backup, in the order
+// they will be restored.
+func (db *database) collections() []*mgo.Collection {
+	return []*mgo.Collection{
+		db.Teams,
+		db.Users,
+		db.Channels,
+		db.Messages,
+		db.Holds,
+		db.Preserved,
+		db.Audit,
+		db.Searches,
+		db.Alerts,
+		db.Settings,
+		db.UserGroups,
+	}
+}
+
+// Backup writes all teams, users, channels, messages, holds, audit records,
+// saved searches and team settings as a gzipped tar archive to w. The
+// archive starts with a manifest containing the checksum of every
+// collection. Encrypted messages are backed up encrypted.
+func (api *api) Backup(w io.Writer) error {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	tmp, err := ioutil.TempDir("", "slackarchive-backup")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	manifest := BackupManifest{
+		Version:     backupVersion,
+		Created:     time.Now(),
+		Collections: []BackupCollection{},
+	}
+
+	for _, c := range db.collections() {
+		bc, err := dumpCollection(c, tmp)
+		if err != nil {
+			return err
+		}
+
+		log.Infof("Backup: %d documents of %s.", bc.Count, bc.Name)
+
+		manifest.Collections = append(manifest.Collections, *bc)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    "manifest.json",
+		Mode:    0640,
+		Size:    int64(len(data)),
+		ModTime: manifest.Created,
+	}); err != nil {
+		return err
+	} else if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, bc := range manifest.Collections {
+		if err := addFile(tw, path.Join(tmp, bc.File), bc.File); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+
+	return gw.Close()
+}
+
+func dumpCollection(c *mgo.Collection, dir string) (*BackupCollection, error) {
+	bc := BackupCollection{
+		Name: c.Name,
+		File: fmt.Sprintf("%s.jsonl", c.Name),
+	}
+
+	f, err := os.Create(path.Join(dir, bc.File))
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	h := sha256.New()
+	bw := bufio.NewWriter(io.MultiWriter(f, h))
+
+	iter := c.Find(nil).Sort("_id").Batch(1000).Iter()
+	defer iter.Close()
+
+	doc := bson.M{}
+	for iter.Next(&doc) {
+		data, err := bson.MarshalJSON(doc)
+		if err != nil {
+			return nil, err
+		}
+
+		// MarshalJSON terminates documents with a newline already
+		if _, err := bw.Write(data); err != nil {
+			return nil, err
+		}
+
+		bc.Count++
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+
+	bc.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return &bc, nil
+}
+
+func addFile(tw *tar.Writer, p string, name string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+
+	hdr.Name = name
+
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// Restore loads a backup archive created by Backup into the database and
+// rebuilds the search index. All checksums are verified before anything is
+// loaded. Unless force is set, the database should be empty.
+func (api *api) Restore(r io.Reader, force bool) error {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	if !force {
+		for _, c := range db.collections() {
+			if count, err := c.Count(); err != nil {
+				return err
+			} else if count > 0 {
+				return fmt.Errorf("Collection %s is not empty", c.Name)
+			}
+		}
+	}
+
+	tmp, err := ioutil.TempDir("", "slackarchive-restore")
+	if err != nil {
+		return err
+	}
+
+	defer os.RemoveAll(tmp)
+
+	manifest, err := extractBackup(r, tmp)
+	if err != nil {
+		return err
+	}
+
+	collections := map[string]*mgo.Collection{}
+	for _, c := range db.collections() {
+		collections[c.Name] = c
+	}
+
+	for _, bc := range manifest.Collections {
+		c, ok := collections[bc.Name]
+		if !ok {
+			log.Warningf("Restore: skipping unknown collection %s.", bc.Name)
+			continue
+		}
+
+		if err := loadCollection(c, path.Join(tmp, bc.File)); err != nil {
+			return err
+		}
+
+		log.Infof("Restore: %d documents of %s.", bc.Count, bc.Name)
+	}
+
+	count, err := api.Reindex()
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Restore: indexed %d messages.", count)
+	return nil
+}
+
+// extractBackup extracts the archive into dir and verifies the checksums
+// of all collections against the manifest.
+func extractBackup(r io.Reader, dir string) (*BackupManifest, error) {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	defer gr.Close()
+
+	var manifest *BackupManifest
+
+	checksums := map[string]string{}
+
+	tr := tar.NewReader(gr)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		name := path.Base(hdr.Name)
+
+		if name == "manifest.json" {
+			manifest = &BackupManifest{}
+			if err := json.NewDecoder(tr).Decode(manifest); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		f, err := os.Create(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+
+		h := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(f, h), tr); err != nil {
+			f.Close()
+			return nil, err
+		}
+
+		f.Close()
+
+		checksums[name] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	if manifest == nil {
+		return nil, fmt.Errorf("Backup does not contain a manifest")
+	} else if manifest.Version != backupVersion {
+		return nil, fmt.Errorf("Unsupported backup version %d", manifest.Version)
+	}
+
+	for _, bc := range manifest.Collections {
+		if sum, ok := checksums[bc.File]; !ok {
+			return nil, fmt.Errorf("Backup is missing %s", bc.File)
+		} else if sum != bc.SHA256 {
+			return nil, fmt.Errorf("Checksum mismatch for %s", bc.File)
+		}
+	}
+
+	return manifest, nil
+}
+
+func loadCollection(c *mgo.Collection, p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+
+	bulk := c.Bulk()
+	bulk.Unordered()
+
+	count := 0
+	for scanner.Scan() {
+		doc := bson.M{}
+		if err := bson.UnmarshalJSON(scanner.Bytes(), &doc); err != nil {
+			return err
+		}
+
+		bulk.Upsert(bson.M{"_id": doc["_id"]}, doc)
+		count++
+
+		if count%1000 != 0 {
+			continue
+		}
+
+		if _, err := bulk.Run(); err != nil {
+			return err
+		}
+
+		bulk = c.Bulk()
+		bulk.Unordered()
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	} else if count%1000 == 0 {
+		return nil
+	}
+
+	_, err = bulk.Run()
+	return err
+}
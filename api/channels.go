@@ -0,0 +1,162 @@
+package api
+
+import (
+	"github.com/nlopes/slack"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	models "github.com/dutchcoders/slackarchive/models"
+	utils "github.com/dutchcoders/slackarchive/utils"
+)
+
+// ChannelEvent is a change of a channel, taken from the archived message of
+// subtype Type. Value is the new topic, purpose or name, OldValue the
+// previous name.
+type ChannelEvent struct {
+	Type      string `json:"type"`
+	User      string `json:"user,omitempty"`
+	Timestamp string `json:"ts"`
+	Value     string `json:"value,omitempty"`
+	OldValue  string `json:"old_value,omitempty"`
+	Inviter   string `json:"inviter,omitempty"`
+}
+
+// ChannelHistory contains the timelines of changes of a channel, oldest
+// first.
+type ChannelHistory struct {
+	Topics     []ChannelEvent `json:"topics"`
+	Purposes   []ChannelEvent `json:"purposes"`
+	Renames    []ChannelEvent `json:"renames"`
+	Membership []ChannelEvent `json:"membership"`
+}
+
+// channelHistory returns the history of channel built from its topic,
+// purpose, name, join and leave messages.
+func channelHistory(db *database, channel *models.Channel) (*ChannelHistory, error) {
+	history := ChannelHistory{
+		Topics:     []ChannelEvent{},
+		Purposes:   []ChannelEvent{},
+		Renames:    []ChannelEvent{},
+		Membership: []ChannelEvent{},
+	}
+
+	iter := db.Messages.Find(bson.M{
+		"team":    channel.Team,
+		"channel": channel.ID,
+		"subtype": bson.M{
+			"$in": []string{
+				"channel_topic", "group_topic",
+				"channel_purpose", "group_purpose",
+				"channel_name", "group_name",
+				"channel_join", "group_join",
+				"channel_leave", "group_leave",
+			},
+		},
+	}).Select(bson.M{
+		"subtype":  1,
+		"user":     1,
+		"ts":       1,
+		"topic":    1,
+		"purpose":  1,
+		"name":     1,
+		"old_name": 1,
+		"inviter":  1,
+	}).Sort("ts").Batch(1000).Iter()
+	defer iter.Close()
+
+	message := models.Message{}
+	for iter.Next(&message) {
+		event := ChannelEvent{
+			Type:      message.SubType,
+			User:      message.User,
+			Timestamp: message.Timestamp,
+		}
+
+		switch message.SubType {
+		case "channel_topic", "group_topic":
+			event.Value = message.Topic
+			history.Topics = append(history.Topics, event)
+		case "channel_purpose", "group_purpose":
+			event.Value = message.Purpose
+			history.Purposes = append(history.Purposes, event)
+		case "channel_name", "group_name":
+			event.Value = message.Name
+			event.OldValue = message.OldName
+			history.Renames = append(history.Renames, event)
+		case "channel_join", "group_join":
+			event.Inviter = message.Inviter
+			history.Membership = append(history.Membership, event)
+		case "channel_leave", "group_leave":
+			history.Membership = append(history.Membership, event)
+		}
+
+		message = models.Message{}
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return &history, nil
+}
+
+// channelHandler returns the metadata of a channel by id or name, with the
+// history of its topic, purpose, name and members.
+func (api *api) channelHandler(ctx *Context) error {
+	type ChannelSetting struct {
+		Value   string         `json:"value"`
+		Creator string         `json:"creator"`
+		LastSet slack.JSONTime `json:"last_set"`
+	}
+
+	type ChannelResponse struct {
+		ID         string          `json:"channel_id"`
+		Name       string          `json:"name"`
+		Team       string          `json:"team"`
+		Creator    string          `json:"creator"`
+		IsChannel  bool            `json:"is_channel"`
+		IsArchived bool            `json:"is_archived"`
+		IsGeneral  bool            `json:"is_general"`
+		IsGroup    bool            `json:"is_group"`
+		IsMember   bool            `json:"is_member"`
+		Topic      ChannelSetting  `json:"topic"`
+		Purpose    ChannelSetting  `json:"purpose"`
+		Members    []string        `json:"members"`
+		NumMembers int             `json:"num_members"`
+		History    *ChannelHistory `json:"history"`
+	}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	channel := models.Channel{}
+	if err := ctx.db.Channels.Find(bson.M{
+		"team":      team.ID,
+		"is_member": true,
+		"$or": []bson.M{
+			bson.M{"_id": ctx.Vars["id"]},
+			bson.M{"name": ctx.Vars["id"]},
+		},
+	}).One(&channel); err == mgo.ErrNotFound {
+		return ErrChannelNotFound
+	} else if err != nil {
+		return err
+	}
+
+	response := ChannelResponse{}
+	if err := utils.Merge(&response, channel); err != nil {
+		log.Error(err.Error())
+	}
+
+	if response.Members == nil {
+		response.Members = []string{}
+	}
+
+	if response.History, err = channelHistory(ctx.db, &channel); err != nil {
+		return err
+	}
+
+	return ctx.Write(response)
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// codeField contains the code blocks and inline code of a message, analyzed
+// with the code analyzer.
+const codeField = "code"
+
+var (
+	codeBlockRe  = regexp.MustCompile("(?s)```(.*?)```")
+	inlineCodeRe = regexp.MustCompile("`([^`\n]+)`")
+)
+
+// extractCode returns the code blocks and inline code in text, unescaped.
+func extractCode(text string) []string {
+	code := []string{}
+
+	add := func(snippet string) {
+		if snippet = strings.TrimSpace(html.UnescapeString(snippet)); snippet != "" {
+			code = append(code, snippet)
+		}
+	}
+
+	for _, matches := range codeBlockRe.FindAllStringSubmatch(text, -1) {
+		add(matches[1])
+	}
+
+	text = codeBlockRe.ReplaceAllString(text, " ")
+
+	for _, matches := range inlineCodeRe.FindAllStringSubmatch(text, -1) {
+		add(matches[1])
+	}
+
+	return code
+}
+
+// codeAnalysis adds the code analyzer to filters and analyzers. Code is
+// split on whitespace only, identifiers are split on punctuation as well
+// while keeping the original, so both `foo.Bar()` and `Bar` match, and
+// operators like `!=` are kept.
+func codeAnalysis(filters, analyzers map[string]interface{}) {
+	filters["code_parts"] = map[string]interface{}{
+		"type":                    "word_delimiter",
+		"preserve_original":       true,
+		"split_on_case_change":    false,
+		"split_on_numerics":       false,
+		"stem_english_possessive": false,
+	}
+
+	analyzers["code"] = map[string]interface{}{
+		"type":      "custom",
+		"tokenizer": "whitespace",
+		"filter":    []string{"code_parts", "lowercase"},
+	}
+}
+
+// codeQuery matches terms against code, quoted terms as a phrase. Unlike the
+// query string syntax, operators are searched for.
+func codeQuery(terms []string) elastic.Query {
+	q := elastic.NewBoolQuery()
+
+	for _, term := range terms {
+		if phrase := strings.Trim(term, `"`); phrase != term {
+			q = q.Must(elastic.NewMatchPhraseQuery(codeField, phrase))
+		} else {
+			q = q.Must(elastic.NewMatchQuery(codeField, term).Operator("and"))
+		}
+	}
+
+	return q
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractCode(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected []string
+	}{
+		{"no code here", []string{}},
+		{"run `make build` first", []string{"make build"}},
+		{"```\nif a != b {\n}\n```", []string{"if a != b {\n}"}},
+		{"```x := &lt;-ch``` and `a &amp;&amp; b`", []string{"x := <-ch", "a && b"}},
+		{"``` ``` and `  `", []string{}},
+		{"`not\ninline`", []string{}},
+		{"```block with `inline` inside``` then `after`", []string{"block with `inline` inside", "after"}},
+	}
+
+	for _, test := range tests {
+		if actual := extractCode(test.text); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%q: expected %q, got %q", test.text, test.expected, actual)
+		}
+	}
+}
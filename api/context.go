@@ -26,6 +26,10 @@ type Context struct {
 	Vars        map[string]string
 	bodyWritten bool
 	store       *sessions.CookieStore
+
+	// user and team are set for requests of signed in users
+	user string
+	team string
 }
 
 type ContextFunc func(*Context) error
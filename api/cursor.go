@@ -0,0 +1,110 @@
+package api
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+)
+
+// maxResultWindow is the maximum offset plus size elasticsearch allows,
+// deeper pages should be retrieved using cursors.
+const maxResultWindow = 10000
+
+// encodeCursor returns an opaque cursor for the sort values of the last item
+// of a page.
+func encodeCursor(values ...interface{}) string {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor returns the sort values within cursor. Numbers are returned
+// as json.Number, to keep their precision.
+func decodeCursor(cursor string, n int) ([]interface{}, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	values := []interface{}{}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return nil, ErrInvalidCursor
+	} else if len(values) != n {
+		return nil, ErrInvalidCursor
+	}
+
+	return values, nil
+}
+
+// pageSize returns the size parameter of ctx, limited to max.
+func pageSize(ctx *Context, def int, max int) (int, error) {
+	val := ctx.r.FormValue("size")
+	if val == "" {
+		return def, nil
+	}
+
+	size, err := strconv.Atoi(val)
+	if err != nil || size < 1 || size > max {
+		return 0, errors.New("invalid-size", "Size should be between 1 and "+strconv.Itoa(max), http.StatusBadRequest)
+	}
+
+	return size, nil
+}
+
+// decodeKeyCursor returns the id within a cursor of a list sorted by id.
+func decodeKeyCursor(cursor string) (string, error) {
+	values, err := decodeCursor(cursor, 1)
+	if err != nil {
+		return "", err
+	}
+
+	id, ok := values[0].(string)
+	if !ok {
+		return "", ErrInvalidCursor
+	}
+
+	return id, nil
+}
+
+// encodeTimeCursor returns a cursor for lists sorted by creation time and
+// id.
+func encodeTimeCursor(t time.Time, id string) string {
+	return encodeCursor(t.Format(time.RFC3339Nano), id)
+}
+
+// decodeTimeCursor returns the creation time and id within a cursor of a
+// list sorted by creation time and id.
+func decodeTimeCursor(cursor string) (time.Time, string, error) {
+	values, err := decodeCursor(cursor, 2)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+
+	s, ok := values[0].(string)
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	id, ok := values[1].(string)
+	if !ok {
+		return time.Time{}, "", ErrInvalidCursor
+	}
+
+	return t, id, nil
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestCursor(t *testing.T) {
+	cursor := encodeCursor(1500000000.000123, "T1-C1-1500000000.000123")
+
+	values, err := decodeCursor(cursor, 2)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+
+	expected := []interface{}{json.Number("1500000000.000123"), "T1-C1-1500000000.000123"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %#v, got %#v", expected, values)
+	}
+
+	tests := []struct {
+		name   string
+		cursor string
+		n      int
+	}{
+		{"not base64", "!!!", 2},
+		{"not json", "WzEs", 2},
+		{"not an array", "eyJhIjoxfQ", 1},
+		{"wrong length", cursor, 3},
+	}
+
+	for _, test := range tests {
+		if _, err := decodeCursor(test.cursor, test.n); err != ErrInvalidCursor {
+			t.Errorf("%s: expected invalid cursor, got %v", test.name, err)
+		}
+	}
+}
+
+func TestKeyCursor(t *testing.T) {
+	if id, err := decodeKeyCursor(encodeCursor("abc")); err != nil || id != "abc" {
+		t.Errorf("expected abc, got %q (%v)", id, err)
+	}
+
+	if _, err := decodeKeyCursor(encodeCursor(1)); err != ErrInvalidCursor {
+		t.Errorf("expected invalid cursor, got %v", err)
+	}
+}
+
+func TestTimeCursor(t *testing.T) {
+	now := time.Date(2017, 3, 1, 12, 30, 0, 123456789, time.UTC)
+
+	created, id, err := decodeTimeCursor(encodeTimeCursor(now, "abc"))
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	} else if !created.Equal(now) || id != "abc" {
+		t.Errorf("expected %s abc, got %s %s", now, created, id)
+	}
+
+	for _, cursor := range []string{
+		encodeCursor("yesterday", "abc"),
+		encodeCursor(now.Format(time.RFC3339Nano), 1),
+		encodeCursor(1, "abc"),
+	} {
+		if _, _, err := decodeTimeCursor(cursor); err != ErrInvalidCursor {
+			t.Errorf("%s: expected invalid cursor, got %v", cursor, err)
+		}
+	}
+}
@@ -7,6 +7,17 @@ type database struct {
 	Teams    *mgo.Collection
 	Users    *mgo.Collection
 	Messages *mgo.Collection
+
+	Holds     *mgo.Collection
+	Preserved *mgo.Collection
+	Audit     *mgo.Collection
+
+	Searches *mgo.Collection
+	Alerts   *mgo.Collection
+
+	Settings *mgo.Collection
+
+	UserGroups *mgo.Collection
 }
 
 func Database(session *mgo.Session) *database {
@@ -18,5 +29,16 @@ func Database(session *mgo.Session) *database {
 	db.Channels = mgodb.C("channels")
 	db.Messages = mgodb.C("messages")
 
+	db.Holds = mgodb.C("holds")
+	db.Preserved = mgodb.C("preserved")
+	db.Audit = mgodb.C("audit")
+
+	db.Searches = mgodb.C("searches")
+	db.Alerts = mgodb.C("alerts")
+
+	db.Settings = mgodb.C("settings")
+
+	db.UserGroups = mgodb.C("usergroups")
+
 	return &db
 }
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/mgo.v2/bson"
+
+	config "github.com/dutchcoders/slackarchive/config"
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+// keyring seals and opens the content of messages using envelope encryption.
+// Every message is encrypted with its own data key, which in turn is
+// encrypted with the active key. Rotating the active key only requires the
+// data keys to be re-encrypted.
+type keyring struct {
+	active string
+	keys   map[string]cipher.AEAD
+}
+
+// sealedContent contains the fields of a message that are encrypted at rest.
+type sealedContent struct {
+	Text             string              `json:"text,omitempty"`
+	Attachments      []models.Attachment `json:"attachments,omitempty"`
+	Preview          string              `json:"preview,omitempty"`
+	PreviewHighlight string              `json:"preview_highlight,omitempty"`
+}
+
+func newKeyring(conf *config.Config) (*keyring, error) {
+	if len(conf.Encryption.Keys) == 0 {
+		return nil, nil
+	}
+
+	k := keyring{
+		active: conf.Encryption.Key,
+		keys:   map[string]cipher.AEAD{},
+	}
+
+	for id, v := range conf.Encryption.Keys {
+		key, err := base64.StdEncoding.DecodeString(v)
+		if err != nil {
+			return nil, fmt.Errorf("Could not decode encryption key %s: %s", id, err.Error())
+		} else if len(key) != 32 {
+			return nil, fmt.Errorf("Encryption key %s should be 32 bytes", id)
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		k.keys[id] = aead
+	}
+
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, fmt.Errorf("Active encryption key %s has not been configured", k.active)
+	}
+
+	return &k, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func (k *keyring) wrap(dataKey []byte) ([]byte, error) {
+	aead := k.keys[k.active]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, dataKey, nil), nil
+}
+
+func (k *keyring) unwrap(id string, wrapped []byte) ([]byte, error) {
+	aead, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("Encryption key %s has not been configured", id)
+	} else if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("Invalid data key")
+	}
+
+	return aead.Open(nil, wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():], nil)
+}
+
+// seal returns a copy of message with its content moved into an envelope,
+// the message itself is left untouched. Without keys the message is returned
+// as is.
+func (k *keyring) seal(message *models.Message) (*models.Message, error) {
+	if k == nil || message.Encrypted != nil {
+		return message, nil
+	}
+
+	content := sealedContent{
+		Text:        message.Text,
+		Attachments: message.Attachments,
+	}
+
+	if message.File != nil {
+		content.Preview = message.File.Preview
+		content.PreviewHighlight = message.File.PreviewHighlight
+	}
+
+	plaintext, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	wrapped, err := k.wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed := *message
+	sealed.Text = ""
+	sealed.Attachments = nil
+
+	if message.File != nil {
+		file := *message.File
+		file.Preview = ""
+		file.PreviewHighlight = ""
+		sealed.File = &file
+	}
+
+	sealed.Encrypted = &models.Envelope{
+		Key:     k.active,
+		DataKey: wrapped,
+		Nonce:   nonce,
+		Data:    aead.Seal(nil, nonce, plaintext, nil),
+	}
+
+	return &sealed, nil
+}
+
+// open restores the content of a sealed message in place.
+func (k *keyring) open(message *models.Message) error {
+	envelope := message.Encrypted
+	if envelope == nil {
+		return nil
+	} else if k == nil {
+		return fmt.Errorf("Message %s is encrypted, but encryption has not been configured", message.ID)
+	}
+
+	dataKey, err := k.unwrap(envelope.Key, envelope.DataKey)
+	if err != nil {
+		return err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return err
+	}
+
+	plaintext, err := aead.Open(nil, envelope.Nonce, envelope.Data, nil)
+	if err != nil {
+		return err
+	}
+
+	content := sealedContent{}
+	if err := json.Unmarshal(plaintext, &content); err != nil {
+		return err
+	}
+
+	message.Text = content.Text
+	message.Attachments = content.Attachments
+
+	if message.File != nil {
+		file := *message.File
+		file.Preview = content.Preview
+		file.PreviewHighlight = content.PreviewHighlight
+		message.File = &file
+	}
+
+	message.Encrypted = nil
+	return nil
+}
+
+// rotate seals plaintext messages and re-encrypts the data key of messages
+// sealed with another key than the active key. It returns whether message
+// has been changed.
+func (k *keyring) rotate(message *models.Message) (bool, error) {
+	if message.Encrypted == nil {
+		sealed, err := k.seal(message)
+		if err != nil {
+			return false, err
+		}
+
+		*message = *sealed
+		return true, nil
+	} else if message.Encrypted.Key == k.active {
+		return false, nil
+	}
+
+	dataKey, err := k.unwrap(message.Encrypted.Key, message.Encrypted.DataKey)
+	if err != nil {
+		return false, err
+	}
+
+	wrapped, err := k.wrap(dataKey)
+	if err != nil {
+		return false, err
+	}
+
+	message.Encrypted.Key = k.active
+	message.Encrypted.DataKey = wrapped
+	return true, nil
+}
+
+// encrypt returns message as it should be stored in the database.
+func (api *api) encrypt(message *models.Message) (*models.Message, error) {
+	return api.keyring.seal(message)
+}
+
+// decrypt restores the content of a message read from the database.
+func (api *api) decrypt(message *models.Message) error {
+	return api.keyring.open(message)
+}
+
+// RotateKeys encrypts all plaintext messages and re-encrypts all data keys
+// with the active key, including preserved versions of held messages.
+func (api *api) RotateKeys() (int, error) {
+	if api.keyring == nil {
+		return 0, fmt.Errorf("Encryption has not been configured")
+	}
+
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	count := 0
+
+	message := models.Message{}
+
+	iter := db.Messages.Find(bson.M{
+		"encrypted.key": bson.M{"$ne": api.keyring.active},
+	}).Batch(1000).Iter()
+	for iter.Next(&message) {
+		if changed, err := api.keyring.rotate(&message); err != nil {
+			iter.Close()
+			return count, err
+		} else if !changed {
+			continue
+		}
+
+		if err := db.Messages.UpdateId(message.ID, &message); err != nil {
+			iter.Close()
+			return count, err
+		}
+
+		count++
+	}
+
+	if err := iter.Close(); err != nil {
+		return count, err
+	}
+
+	preserved := models.PreservedMessage{}
+
+	iter = db.Preserved.Find(bson.M{
+		"message.encrypted.key": bson.M{"$ne": api.keyring.active},
+	}).Batch(1000).Iter()
+	for iter.Next(&preserved) {
+		if changed, err := api.keyring.rotate(&preserved.Message); err != nil {
+			iter.Close()
+			return count, err
+		} else if !changed {
+			continue
+		}
+
+		if err := db.Preserved.UpdateId(preserved.ID, &preserved); err != nil {
+			iter.Close()
+			return count, err
+		}
+
+		count++
+	}
+
+	if err := iter.Close(); err != nil {
+		return count, err
+	}
+
+	log.Infof("Rotated %d messages to encryption key %s.", count, api.keyring.active)
+	return count, nil
+}
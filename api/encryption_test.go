@@ -0,0 +1,176 @@
+package api
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+
+	config "github.com/dutchcoders/slackarchive/config"
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+func testKeyring(t *testing.T, active string, ids ...string) *keyring {
+	conf := &config.Config{}
+	conf.Encryption.Key = active
+	conf.Encryption.Keys = map[string]string{}
+
+	for _, id := range ids {
+		conf.Encryption.Keys[id] = base64.StdEncoding.EncodeToString([]byte(strings.Repeat(id[:1], 32)))
+	}
+
+	k, err := newKeyring(conf)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+
+	return k
+}
+
+func testMessage() *models.Message {
+	return &models.Message{
+		ID:   "T1-C1-1500000000.000100",
+		Text: "the password is hunter2",
+		Attachments: []models.Attachment{
+			{Title: "secret", Text: "attached"},
+		},
+		File: &models.File{
+			ID:               "F1",
+			Name:             "notes.txt",
+			Preview:          "preview",
+			PreviewHighlight: "highlight",
+		},
+	}
+}
+
+func TestNewKeyring(t *testing.T) {
+	key := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("a", 32)))
+
+	tests := []struct {
+		name string
+		key  string
+		keys map[string]string
+		err  bool
+	}{
+		{"not configured", "", nil, false},
+		{"valid", "a", map[string]string{"a": key}, false},
+		{"not base64", "a", map[string]string{"a": "!!!"}, true},
+		{"short key", "a", map[string]string{"a": base64.StdEncoding.EncodeToString([]byte("short"))}, true},
+		{"unknown active key", "b", map[string]string{"a": key}, true},
+	}
+
+	for _, test := range tests {
+		conf := &config.Config{}
+		conf.Encryption.Key = test.key
+		conf.Encryption.Keys = test.keys
+
+		if _, err := newKeyring(conf); (err != nil) != test.err {
+			t.Errorf("%s: expected error %t, got %v", test.name, test.err, err)
+		}
+	}
+}
+
+func TestKeyringSealOpen(t *testing.T) {
+	k := testKeyring(t, "a", "a")
+
+	message := testMessage()
+
+	sealed, err := k.seal(message)
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(message, testMessage()) {
+		t.Errorf("expected message to be left untouched")
+	}
+
+	if sealed.Encrypted == nil || sealed.Encrypted.Key != "a" {
+		t.Fatalf("expected message to be sealed with key a")
+	} else if sealed.Text != "" || sealed.Attachments != nil || sealed.File.Preview != "" || sealed.File.PreviewHighlight != "" {
+		t.Errorf("expected content to be removed, got %+v", sealed)
+	} else if sealed.File.Name != "notes.txt" {
+		t.Errorf("expected file metadata to be kept")
+	}
+
+	// sealing twice keeps the envelope
+	if again, err := k.seal(sealed); err != nil || again != sealed {
+		t.Errorf("expected sealed message to be returned as is")
+	}
+
+	if err := k.open(sealed); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+
+	if !reflect.DeepEqual(sealed, testMessage()) {
+		t.Errorf("expected %+v, got %+v", testMessage(), sealed)
+	}
+
+	// tampered data is not opened
+	sealed, _ = k.seal(message)
+	sealed.Encrypted.Data[0] ^= 0xff
+
+	if err := k.open(sealed); err == nil {
+		t.Errorf("expected error opening tampered message")
+	}
+}
+
+func TestKeyringNotConfigured(t *testing.T) {
+	var k *keyring
+
+	message := testMessage()
+	if sealed, err := k.seal(message); err != nil || sealed != message {
+		t.Errorf("expected message to be returned as is")
+	}
+
+	sealed, _ := testKeyring(t, "a", "a").seal(message)
+	if err := k.open(sealed); err == nil {
+		t.Errorf("expected error opening sealed message without keys")
+	}
+
+	if err := k.open(message); err != nil {
+		t.Errorf("unexpected error %s", err.Error())
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	old := testKeyring(t, "a", "a")
+	k := testKeyring(t, "b", "a", "b")
+
+	sealed, err := old.seal(testMessage())
+	if err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	}
+
+	data := sealed.Encrypted.Data
+
+	if changed, err := k.rotate(sealed); err != nil || !changed {
+		t.Fatalf("expected data key to be rotated, got %v", err)
+	} else if sealed.Encrypted.Key != "b" {
+		t.Errorf("expected key b, got %s", sealed.Encrypted.Key)
+	} else if !reflect.DeepEqual(sealed.Encrypted.Data, data) {
+		t.Errorf("expected content to be left encrypted with the same data key")
+	}
+
+	if changed, err := k.rotate(sealed); err != nil || changed {
+		t.Errorf("expected message sealed with the active key to be unchanged")
+	}
+
+	// the old keyring no longer has the active key
+	if err := old.open(sealed); err == nil {
+		t.Errorf("expected error opening with keyring without key b")
+	}
+
+	if err := k.open(sealed); err != nil {
+		t.Fatalf("unexpected error %s", err.Error())
+	} else if !reflect.DeepEqual(sealed, testMessage()) {
+		t.Errorf("expected %+v, got %+v", testMessage(), sealed)
+	}
+
+	// plaintext messages are sealed
+	message := testMessage()
+	if changed, err := k.rotate(message); err != nil || !changed {
+		t.Fatalf("expected plaintext message to be sealed, got %v", err)
+	} else if message.Encrypted == nil || message.Encrypted.Key != "b" || message.Text != "" {
+		t.Errorf("expected message to be sealed with key b")
+	}
+}
@@ -35,4 +35,11 @@ var (
 	ErrDatabaseAlreadyExists               = errors.New("already-exists", "Already exists", 409)
 	ErrDatabaseOther                       = errors.New("other", "Other", 500)
 	ErrCertificateVerificationFailed       = errors.New("certificate-verification-failed", "Certificate verification failed", 417)
+	ErrHoldNotFound                        = errors.New("hold-not-found", "Hold not found", 404)
+	ErrMessageNotFound                     = errors.New("message-not-found", "Message not found", 404)
+	ErrInvalidCursor                       = errors.New("invalid-cursor", "Invalid cursor", http.StatusBadRequest)
+	ErrResultWindowExceeded                = errors.New("result-window-exceeded", "Offset and size exceed 10000 results, use the cursor instead", http.StatusBadRequest)
+	ErrSearchNotFound                      = errors.New("search-not-found", "Saved search not found", 404)
+	ErrChannelNotFound                     = errors.New("channel-not-found", "Channel not found", 404)
+	ErrHoldReleased                        = errors.New("hold-released", "Hold has been released already", 409)
 )
@@ -0,0 +1,257 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// intervals contains the supported timeline intervals in seconds.
+var intervals = map[string]float64{
+	"hour": 60 * 60,
+	"day":  24 * 60 * 60,
+	"week": 7 * 24 * 60 * 60,
+}
+
+// timelineIntervals contains the supported timeline intervals, from fine to
+// coarse.
+var timelineIntervals = []string{"hour", "day", "week"}
+
+// maxTimelineBuckets is the maximum number of buckets of a timeline, larger
+// timelines exceed the bucket limit of Elasticsearch.
+const maxTimelineBuckets = 1000
+
+// offsetHistogram is a histogram aggregation with buckets shifted by offset.
+// The histogram aggregation of the client doesn't support offsets.
+type offsetHistogram struct {
+	*elastic.HistogramAggregation
+
+	offset float64
+}
+
+func (a offsetHistogram) Source() (interface{}, error) {
+	src, err := a.HistogramAggregation.Source()
+	if err != nil {
+		return nil, err
+	}
+
+	if source, ok := src.(map[string]interface{}); !ok {
+	} else if histogram, ok := source["histogram"].(map[string]interface{}); !ok {
+	} else {
+		histogram["offset"] = a.offset
+	}
+
+	return src, nil
+}
+
+// timelineHistogram returns a histogram of the number of messages per
+// interval, hour, day or week.
+func timelineHistogram(interval string) (offsetHistogram, error) {
+	seconds, ok := intervals[interval]
+	if !ok {
+		return offsetHistogram{}, errors.New("invalid-interval", "Interval should be hour, day or week", http.StatusBadRequest)
+	}
+
+	histogram := elastic.NewHistogramAggregation().
+		Field("ts.float").
+		Interval(seconds).
+		MinDocCount(0)
+
+	// the epoch is on a thursday, let weeks start on monday
+	offset := float64(0)
+	if interval == "week" {
+		offset = 4 * 24 * 60 * 60
+	}
+
+	return offsetHistogram{histogram, offset}, nil
+}
+
+// FacetBucket contains the number of messages for a channel or user.
+type FacetBucket struct {
+	Key   string `json:"key"`
+	Count int64  `json:"count"`
+}
+
+// TimelineBucket contains the number of messages in the interval starting
+// at ts.
+type TimelineBucket struct {
+	Timestamp float64 `json:"ts"`
+	Count     int64   `json:"count"`
+}
+
+// facetsHandler returns the number of messages per channel, user and time
+// interval matching the search parameters, and how many of them contain
+// files or links.
+func (api *api) facetsHandler(ctx *Context) error {
+	response := struct {
+		TotalCount int64         `json:"total"`
+		Channels   []FacetBucket `json:"channels"`
+		Users      []FacetBucket `json:"users"`
+		Timeline   struct {
+			Interval string           `json:"interval"`
+			Buckets  []TimelineBucket `json:"buckets"`
+		} `json:"timeline"`
+		Has struct {
+			File int64 `json:"file"`
+			Link int64 `json:"link"`
+		} `json:"has"`
+	}{
+		Channels: []FacetBucket{},
+		Users:    []FacetBucket{},
+	}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	response.Timeline.Interval = "day"
+	response.Timeline.Buckets = []TimelineBucket{}
+
+	if val := ctx.r.FormValue("interval"); val != "" {
+		response.Timeline.Interval = val
+	}
+
+	if _, ok := intervals[response.Timeline.Interval]; !ok {
+		return errors.New("invalid-interval", "Interval should be hour, day or week", http.StatusBadRequest)
+	}
+
+	size := 10
+	if val, err := strconv.Atoi(ctx.r.FormValue("size")); err == nil && val > 0 && val <= 100 {
+		size = val
+	}
+
+	_, qs, pf, err := api.messagesQuery(ctx, team, false)
+	if err != nil {
+		return err
+	}
+
+	// the channel facet counts all channels, the other facets the
+	// selected channel only
+	channels, err := visibleChannels(ctx.db, team.ID, "")
+	if err != nil {
+		return err
+	}
+
+	qs = qs.Filter(elastic.NewTermsQuery("channel.raw", channels...))
+
+	if response.Timeline.Interval, err = api.timelineInterval(qs, pf, response.Timeline.Interval); err != nil {
+		return err
+	}
+
+	timeline, err := timelineHistogram(response.Timeline.Interval)
+	if err != nil {
+		return err
+	}
+
+	selected := elastic.NewFilterAggregation().
+		Filter(pf).
+		SubAggregation("users", elastic.NewTermsAggregation().Field("user.raw").Size(size).OrderByCountDesc()).
+		SubAggregation("timeline", timeline).
+		SubAggregation("has_file", elastic.NewFilterAggregation().Filter(elastic.NewExistsQuery("file.id"))).
+		SubAggregation("has_link", elastic.NewFilterAggregation().Filter(hasLinkQuery()))
+
+	ss := elastic.NewSearchSource().
+		Query(qs).
+		Size(0).
+		Aggregation("channels", elastic.NewTermsAggregation().Field("channel.raw").Size(size).OrderByCountDesc()).
+		Aggregation("selected", selected)
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	if agg, ok := searchResult.Aggregations.Terms("channels"); ok {
+		for _, bucket := range agg.Buckets {
+			response.Channels = append(response.Channels, FacetBucket{
+				Key:   bucket.Key.(string),
+				Count: bucket.DocCount,
+			})
+		}
+	}
+
+	agg, ok := searchResult.Aggregations.Filter("selected")
+	if !ok {
+		return ctx.Write(response)
+	}
+
+	response.TotalCount = agg.DocCount
+
+	if users, ok := agg.Terms("users"); ok {
+		for _, bucket := range users.Buckets {
+			response.Users = append(response.Users, FacetBucket{
+				Key:   bucket.Key.(string),
+				Count: bucket.DocCount,
+			})
+		}
+	}
+
+	if timeline, ok := agg.Histogram("timeline"); ok {
+		for _, bucket := range timeline.Buckets {
+			response.Timeline.Buckets = append(response.Timeline.Buckets, TimelineBucket{
+				Timestamp: bucket.Key,
+				Count:     bucket.DocCount,
+			})
+		}
+	}
+
+	if file, ok := agg.Filter("has_file"); ok {
+		response.Has.File = file.DocCount
+	}
+
+	if link, ok := agg.Filter("has_link"); ok {
+		response.Has.Link = link.DocCount
+	}
+
+	return ctx.Write(response)
+}
+
+// timelineInterval returns interval, or the first coarser interval for which
+// the timeline of the messages matching qs and pf has at most
+// maxTimelineBuckets buckets.
+func (api *api) timelineInterval(qs, pf elastic.Query, interval string) (string, error) {
+	ss := elastic.NewSearchSource().
+		Query(elastic.NewBoolQuery().Filter(qs, pf)).
+		Size(0).
+		Aggregation("first", elastic.NewMinAggregation().Field("ts.float")).
+		Aggregation("last", elastic.NewMaxAggregation().Field("ts.float"))
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return "", err
+	}
+
+	first, ok := searchResult.Aggregations.Min("first")
+	if !ok || first.Value == nil {
+		return interval, nil
+	}
+
+	last, ok := searchResult.Aggregations.Max("last")
+	if !ok || last.Value == nil {
+		return interval, nil
+	}
+
+	return coarserInterval(interval, *last.Value-*first.Value)
+}
+
+// coarserInterval returns interval, or the first coarser interval that
+// divides span seconds in at most maxTimelineBuckets buckets.
+func coarserInterval(interval string, span float64) (string, error) {
+	coarser := false
+	for _, candidate := range timelineIntervals {
+		if candidate == interval {
+			coarser = true
+		}
+
+		if coarser && span/intervals[candidate] <= maxTimelineBuckets {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.New("invalid-range", "Period contains too many intervals, use a larger interval", http.StatusBadRequest)
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestTimelineHistogram(t *testing.T) {
+	tests := []struct {
+		interval string
+		seconds  float64
+		offset   float64
+		err      bool
+	}{
+		{interval: "hour", seconds: 3600, offset: 0},
+		{interval: "day", seconds: 86400, offset: 0},
+		// the epoch is on a thursday, weeks start four days later
+		{interval: "week", seconds: 604800, offset: 345600},
+		{interval: "month", err: true},
+		{interval: "", err: true},
+	}
+
+	for _, test := range tests {
+		histogram, err := timelineHistogram(test.interval)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.interval)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("%q: unexpected error %s", test.interval, err.Error())
+			continue
+		}
+
+		src, err := histogram.Source()
+		if err != nil {
+			t.Errorf("%q: unexpected error %s", test.interval, err.Error())
+			continue
+		}
+
+		source := src.(map[string]interface{})["histogram"].(map[string]interface{})
+		if source["interval"] != test.seconds || source["offset"] != test.offset || source["field"] != "ts.float" {
+			t.Errorf("%q: expected interval %v and offset %v, got %+v", test.interval, test.seconds, test.offset, source)
+		}
+	}
+}
+
+func TestCoarserInterval(t *testing.T) {
+	day := float64(24 * 60 * 60)
+
+	tests := []struct {
+		interval string
+		span     float64
+		expected string
+		err      bool
+	}{
+		{interval: "hour", span: 0, expected: "hour"},
+		{interval: "hour", span: 1000 * 60 * 60, expected: "hour"},
+		{interval: "hour", span: 1000*60*60 + 1, expected: "day"},
+		{interval: "day", span: 30 * day, expected: "day"},
+		{interval: "hour", span: 1000 * day, expected: "day"},
+		{interval: "hour", span: 1000*day + 1, expected: "week"},
+		{interval: "day", span: 10 * 365 * day, expected: "week"},
+		{interval: "week", span: 1, expected: "week"},
+		{interval: "week", span: 7000 * day, expected: "week"},
+		{interval: "week", span: 7000*day + 1, err: true},
+		{interval: "hour", span: 100 * 365 * day, err: true},
+	}
+
+	for _, test := range tests {
+		interval, err := coarserInterval(test.interval, test.span)
+		if test.err {
+			if err == nil {
+				t.Errorf("%s %v: expected error", test.interval, test.span)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("%s %v: unexpected error %s", test.interval, test.span, err.Error())
+			continue
+		}
+
+		if interval != test.expected {
+			t.Errorf("%s %v: expected %s, got %s", test.interval, test.span, test.expected, interval)
+		}
+	}
+}
@@ -0,0 +1,436 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+	utils "github.com/dutchcoders/slackarchive/utils"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+const redactedText = "[redacted]"
+
+func (api *api) audit(db *database, record *models.AuditRecord) error {
+	record.ID = utils.NewUUID().String()
+	record.CreatedAt = time.Now()
+
+	log.Infof("Audit: %s of %s by %s", record.Action, record.Subject, record.Actor)
+
+	return db.Audit.Insert(record)
+}
+
+// ExportUser writes everything archived for user id as json to w: the
+// profile, channel memberships, messages, files, preserved versions of held
+// messages and saved searches.
+func (api *api) ExportUser(id, actor string, w io.Writer) error {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	user := models.User{}
+	if err := db.Users.FindId(id).One(&user); err == mgo.ErrNotFound {
+		return ErrUserNotFound
+	} else if err != nil {
+		return err
+	}
+
+	channels := []string{}
+	if err := db.Channels.Find(bson.M{"members": id}).Distinct("_id", &channels); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+
+	write := func(s string) error {
+		_, err := io.WriteString(w, s)
+		return err
+	}
+
+	if err := write(`{"user":`); err != nil {
+		return err
+	} else if err := enc.Encode(user); err != nil {
+		return err
+	} else if err := write(`,"channels":`); err != nil {
+		return err
+	} else if err := enc.Encode(channels); err != nil {
+		return err
+	} else if err := write(`,"messages":[`); err != nil {
+		return err
+	}
+
+	files := []*models.File{}
+	seen := map[string]bool{}
+
+	iter := db.Messages.Find(bson.M{"team": user.Team, "user": id}).Sort("ts").Iter()
+	defer iter.Close()
+
+	count := 0
+
+	message := models.Message{}
+	for iter.Next(&message) {
+		if err := api.decrypt(&message); err != nil {
+			return err
+		}
+
+		if count > 0 {
+			if err := write(","); err != nil {
+				return err
+			}
+		}
+
+		if err := enc.Encode(message); err != nil {
+			return err
+		}
+
+		if message.File != nil && !seen[message.File.ID] {
+			seen[message.File.ID] = true
+			files = append(files, message.File)
+		}
+
+		count++
+	}
+
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	preserved := []models.PreservedMessage{}
+	if err := db.Preserved.Find(bson.M{"message.user": id}).All(&preserved); err != nil {
+		return err
+	}
+
+	for i := range preserved {
+		if err := api.decrypt(&preserved[i].Message); err != nil {
+			return err
+		}
+	}
+
+	searches := []models.SavedSearch{}
+	if err := db.Searches.Find(bson.M{"team": user.Team, "user": id}).All(&searches); err != nil {
+		return err
+	}
+
+	if err := write(`],"files":`); err != nil {
+		return err
+	} else if err := enc.Encode(files); err != nil {
+		return err
+	} else if err := write(`,"preserved":`); err != nil {
+		return err
+	} else if err := enc.Encode(preserved); err != nil {
+		return err
+	} else if err := write(`,"searches":`); err != nil {
+		return err
+	} else if err := enc.Encode(searches); err != nil {
+		return err
+	} else if err := write("}\n"); err != nil {
+		return err
+	}
+
+	return api.audit(db, &models.AuditRecord{
+		Action:  "export",
+		Team:    user.Team,
+		Subject: id,
+		Actor:   actor,
+		Details: map[string]interface{}{
+			"messages": count,
+			"files":    len(files),
+		},
+	})
+}
+
+// EraseUser pseudonymizes the profile of user id, redacts the text, attachments
+// and files of their messages in mongo and elasticsearch and scrubs their id
+// from channel members and mentions. Messages under legal hold are left
+// untouched. Saved searches and alerts of the user and their autocomplete
+// document are removed.
+func (api *api) EraseUser(id, actor, reason string) (*models.AuditRecord, error) {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	user := models.User{}
+	if err := db.Users.FindId(id).One(&user); err == mgo.ErrNotFound {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	holds, err := activeHolds(db, user.Team)
+	if err != nil {
+		return nil, err
+	}
+
+	pseudonym := fmt.Sprintf("deleted-%s", hash(id)[:8])
+
+	bulk := api.es.Bulk()
+
+	flush := func(force bool) error {
+		if bulk.NumberOfActions() == 0 {
+			return nil
+		} else if !force && bulk.NumberOfActions() < 500 {
+			return nil
+		}
+
+		_, err := bulk.Do(context.Background())
+		return err
+	}
+
+	update := func(message *models.Message) error {
+		if stored, err := api.encrypt(message); err != nil {
+			return err
+		} else if err := db.Messages.UpdateId(message.ID, stored); err != nil {
+			return err
+		}
+
+		doc, err := api.document(db, message)
+		if err != nil {
+			return err
+		}
+
+		bulk.Index(messagesIndex, message.ID, doc)
+
+		return flush(false)
+	}
+
+	redacted, held, scrubbed := 0, 0, 0
+
+	message := models.Message{}
+
+	iter := db.Messages.Find(bson.M{"team": user.Team, "user": id}).Iter()
+	for iter.Next(&message) {
+		if len(holds.Covers(&message)) > 0 {
+			held++
+			continue
+		}
+
+		// drops the envelope, the redacted message will be sealed again
+		message.Encrypted = nil
+
+		message.Text = redactedText
+		message.Attachments = nil
+		message.File = nil
+		message.Comment = nil
+
+		if err := update(&message); err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		redacted++
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	mention := regexp.MustCompile(fmt.Sprintf(`<@%s(\|[^>]*)?>`, regexp.QuoteMeta(id)))
+
+	pattern := bson.RegEx{Pattern: regexp.QuoteMeta("<@" + id)}
+
+	candidates := []bson.M{
+		bson.M{"text": pattern},
+		bson.M{"attachments.text": pattern},
+		bson.M{"attachments.pretext": pattern},
+		bson.M{"attachments.fallback": pattern},
+		bson.M{"members": id},
+	}
+
+	if api.keyring != nil {
+		// the text of encrypted messages can only be matched after decryption
+		candidates = append(candidates, bson.M{"encrypted": bson.M{"$exists": true}})
+	}
+
+	// replace returns s with the mentions of the user replaced by the
+	// pseudonym, and whether it contained any
+	replace := func(s *string) bool {
+		if !mention.MatchString(*s) {
+			return false
+		}
+
+		*s = mention.ReplaceAllString(*s, "@"+pseudonym)
+		return true
+	}
+
+	iter = db.Messages.Find(bson.M{
+		"team": user.Team,
+		"$or":  candidates,
+	}).Iter()
+	for iter.Next(&message) {
+		if err := api.decrypt(&message); err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		members := []string{}
+		for _, member := range message.Members {
+			if member != id {
+				members = append(members, member)
+			}
+		}
+
+		// the attachments are copied, as the message is only updated when
+		// it isn't held
+		text := message.Text
+		attachments := append([]models.Attachment{}, message.Attachments...)
+
+		mentioned := replace(&text)
+		for i := range attachments {
+			mentioned = replace(&attachments[i].Text) || mentioned
+			mentioned = replace(&attachments[i].Pretext) || mentioned
+			mentioned = replace(&attachments[i].Fallback) || mentioned
+		}
+
+		if len(members) == len(message.Members) && !mentioned {
+			continue
+		} else if len(holds.Covers(&message)) > 0 {
+			held++
+			continue
+		}
+
+		message.Text = text
+		message.Attachments = attachments
+		message.Members = members
+
+		if err := update(&message); err != nil {
+			iter.Close()
+			return nil, err
+		}
+
+		scrubbed++
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	if err := flush(true); err != nil {
+		return nil, err
+	}
+
+	info, err := db.Channels.UpdateAll(bson.M{"members": id}, bson.M{"$pull": bson.M{"members": id}})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.UserGroups.UpdateAll(bson.M{"users": id}, bson.M{"$pull": bson.M{"users": id}}); err != nil {
+		return nil, err
+	}
+
+	searches, err := db.Searches.RemoveAll(bson.M{"team": user.Team, "user": id})
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Alerts.RemoveAll(bson.M{"team": user.Team, "user": id}); err != nil {
+		return nil, err
+	}
+
+	user.Name = pseudonym
+	user.Deleted = true
+	user.Color = ""
+	user.Presence = ""
+	user.Profile = models.UserProfile{
+		RealName:           pseudonym,
+		RealNameNormalized: pseudonym,
+	}
+
+	if err := db.Users.UpdateId(id, &user); err != nil {
+		return nil, err
+	}
+
+	// the name would be completed until the next autocomplete update
+	completion, _ := Completion{Kind: "user", ID: id}.document(user.Team, 0)
+	if err := api.es.Delete(context.Background(), autocompleteIndex, completion); err != nil && !elastic.IsNotFound(err) {
+		return nil, err
+	}
+
+	record := models.AuditRecord{
+		Action:  "erase",
+		Team:    user.Team,
+		Subject: id,
+		Actor:   actor,
+		Reason:  reason,
+		Details: map[string]interface{}{
+			"pseudonym":         pseudonym,
+			"messages_redacted": redacted,
+			"messages_held":     held,
+			"messages_scrubbed": scrubbed,
+			"channels_scrubbed": info.Updated,
+			"searches_removed":  searches.Removed,
+		},
+	}
+
+	if err := api.audit(db, &record); err != nil {
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+func (api *api) exportUserHandler(ctx *Context) error {
+	actor := ctx.r.FormValue("actor")
+
+	verr := &errors.ValidationError{}
+	if actor == "" {
+		verr.Add("actor", "required", "Actor is required")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	if count, err := ctx.db.Users.FindId(ctx.Vars["id"]).Count(); err != nil {
+		return err
+	} else if count == 0 {
+		return ErrUserNotFound
+	}
+
+	ctx.w.Header().Set("Content-Type", "application/json")
+	ctx.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.json", ctx.Vars["id"]))
+	ctx.bodyWritten = true
+
+	return api.ExportUser(ctx.Vars["id"], actor, ctx.w)
+}
+
+func (api *api) eraseUserHandler(ctx *Context) error {
+	request := struct {
+		Actor  string `json:"actor"`
+		Reason string `json:"reason"`
+	}{}
+
+	if err := ctx.Read(&request); err != nil {
+		return err
+	}
+
+	verr := &errors.ValidationError{}
+	if request.Actor == "" {
+		verr.Add("actor", "required", "Actor is required")
+	}
+
+	if request.Reason == "" {
+		verr.Add("reason", "required", "Reason is required")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	record, err := api.EraseUser(ctx.Vars["id"], request.Actor, request.Reason)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Write(record)
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"strings"
+
+	models "github.com/dutchcoders/slackarchive/models"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// Highlighted fragments are marked with characters from the unicode private
+// use area, which don't occur in messages, and are converted into spans.
+const (
+	highlightStart = "\ue000"
+	highlightEnd   = "\ue001"
+)
+
+// Span is a highlighted part of a field, Start and End are offsets in
+// unicode code points, End is exclusive.
+type Span struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Highlight contains the highlighted spans of a field. Index is the index of
+// the attachment for attachment fields.
+type Highlight struct {
+	Field string `json:"field"`
+	Index *int   `json:"index,omitempty"`
+	Spans []Span `json:"spans"`
+}
+
+// messagesHighlight returns the highlighter for messages.
+func messagesHighlight() *elastic.Highlight {
+	return elastic.
+		NewHighlight().
+		PreTags(highlightStart).
+		PostTags(highlightEnd).
+		RequireFieldMatch(false).
+		NumOfFragments(0).
+		Fields(
+			elastic.NewHighlighterField("text"),
+			elastic.NewHighlighterField("text_*"),
+			elastic.NewHighlighterField("attachments.text"),
+			elastic.NewHighlighterField("file.title"),
+			elastic.NewHighlighterField("file.preview"),
+		)
+}
+
+// highlightSpans returns the spans marked in highlighted, and whether
+// highlighted without markers equals original.
+func highlightSpans(highlighted string, original string) ([]Span, bool) {
+	spans := []Span{}
+
+	text := strings.Builder{}
+
+	offset, start := 0, -1
+	for _, r := range highlighted {
+		switch string(r) {
+		case highlightStart:
+			start = offset
+		case highlightEnd:
+			if start >= 0 && start < offset {
+				spans = append(spans, Span{Start: start, End: offset})
+			}
+
+			start = -1
+		default:
+			text.WriteRune(r)
+			offset++
+		}
+	}
+
+	if text.String() != original {
+		return nil, false
+	}
+
+	return expandMentions(spans, original), true
+}
+
+// expandMentions widens spans that partially cover a mention or channel
+// reference like <@U123|name>, so they cover the complete reference.
+func expandMentions(spans []Span, text string) []Span {
+	refs := []Span{}
+
+	offset, start := 0, -1
+	for i, r := range text {
+		if r == '<' && (strings.HasPrefix(text[i:], "<@") || strings.HasPrefix(text[i:], "<#")) {
+			start = offset
+		} else if r == '>' && start >= 0 {
+			refs = append(refs, Span{Start: start, End: offset + 1})
+			start = -1
+		}
+
+		offset++
+	}
+
+	for i := range spans {
+		for _, ref := range refs {
+			if spans[i].Start < ref.End && ref.Start < spans[i].End {
+				if ref.Start < spans[i].Start {
+					spans[i].Start = ref.Start
+				}
+
+				if ref.End > spans[i].End {
+					spans[i].End = ref.End
+				}
+			}
+		}
+	}
+
+	return spans
+}
+
+// highlights returns the highlighted spans of hit for message.
+func highlights(hit *elastic.SearchHit, message *models.Message, language string) []Highlight {
+	result := []Highlight{}
+	if hit.Highlight == nil {
+		return result
+	}
+
+	add := func(field string, index *int, highlighted string, original string) {
+		if spans, ok := highlightSpans(highlighted, original); !ok {
+			log.Debugf("Highlight of %s for message %s doesn't match", field, message.ID)
+		} else if len(spans) > 0 {
+			result = append(result, Highlight{Field: field, Index: index, Spans: spans})
+		}
+	}
+
+	if hl, ok := hit.Highlight["text"]; ok {
+		add("text", nil, hl[0], message.Text)
+	} else if hl, ok := hit.Highlight[languageField(language)]; ok {
+		// matched the text analyzed for its language only
+		add("text", nil, hl[0], message.Text)
+	}
+
+	// only values with highlights are returned, find the attachment each
+	// belongs to
+	used := map[int]bool{}
+	for _, highlighted := range hit.Highlight["attachments.text"] {
+		text := strings.Replace(strings.Replace(highlighted, highlightStart, "", -1), highlightEnd, "", -1)
+
+		for i, attachment := range message.Attachments {
+			if used[i] || attachment.Text != text {
+				continue
+			}
+
+			index := i
+			used[i] = true
+
+			add("attachments.text", &index, highlighted, attachment.Text)
+			break
+		}
+	}
+
+	if message.File == nil {
+		return result
+	}
+
+	if hl, ok := hit.Highlight["file.title"]; ok {
+		add("file.title", nil, hl[0], message.File.Title)
+	}
+
+	if hl, ok := hit.Highlight["file.preview"]; ok {
+		add("file.preview", nil, hl[0], message.File.Preview)
+	}
+
+	return result
+}
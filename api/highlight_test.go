@@ -0,0 +1,147 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/dutchcoders/slackarchive/models"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+func TestHighlightSpans(t *testing.T) {
+	tests := []struct {
+		name        string
+		highlighted string
+		original    string
+		expected    []Span
+		ok          bool
+	}{
+		{
+			name:        "none",
+			highlighted: "deploy prod",
+			original:    "deploy prod",
+			expected:    []Span{},
+			ok:          true,
+		},
+		{
+			name:        "multiple",
+			highlighted: "\ue000deploy\ue001 to \ue000prod\ue001",
+			original:    "deploy to prod",
+			expected:    []Span{{Start: 0, End: 6}, {Start: 10, End: 14}},
+			ok:          true,
+		},
+		{
+			name:        "unicode",
+			highlighted: "héllo wörld 🎉 \ue000deploy\ue001",
+			original:    "héllo wörld 🎉 deploy",
+			expected:    []Span{{Start: 14, End: 20}},
+			ok:          true,
+		},
+		{
+			name:        "inside a mention",
+			highlighted: "ping <@U123|\ue000alice\ue001> now",
+			original:    "ping <@U123|alice> now",
+			expected:    []Span{{Start: 5, End: 18}},
+			ok:          true,
+		},
+		{
+			name:        "overlapping a channel reference",
+			highlighted: "see <#C1|\ue000general> now\ue001",
+			original:    "see <#C1|general> now",
+			expected:    []Span{{Start: 4, End: 21}},
+			ok:          true,
+		},
+		{
+			name:        "links aren't expanded",
+			highlighted: "<https://\ue000example\ue001.com>",
+			original:    "<https://example.com>",
+			expected:    []Span{{Start: 9, End: 16}},
+			ok:          true,
+		},
+		{
+			name:        "empty",
+			highlighted: "\ue000\ue001deploy",
+			original:    "deploy",
+			expected:    []Span{},
+			ok:          true,
+		},
+		{
+			name:        "different text",
+			highlighted: "\ue000deploy\ue001 prod",
+			original:    "deploy staging",
+			ok:          false,
+		},
+	}
+
+	for _, test := range tests {
+		spans, ok := highlightSpans(test.highlighted, test.original)
+		if ok != test.ok {
+			t.Errorf("%s: expected ok %t, got %t", test.name, test.ok, ok)
+		} else if !reflect.DeepEqual(spans, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, spans)
+		}
+	}
+}
+
+func TestHighlights(t *testing.T) {
+	index := func(i int) *int {
+		return &i
+	}
+
+	message := &models.Message{
+		ID:   "T1-C1-1500000000.000100",
+		Text: "deploy naar productie",
+		Attachments: []models.Attachment{
+			{Text: "build failed"},
+			{Text: "deploy failed"},
+			{Text: "deploy failed"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		highlight elastic.SearchHitHighlight
+		expected  []Highlight
+	}{
+		{
+			name:      "none",
+			highlight: nil,
+			expected:  []Highlight{},
+		},
+		{
+			name: "language field",
+			highlight: elastic.SearchHitHighlight{
+				"text_nl": {"deploy naar \ue000productie\ue001"},
+			},
+			expected: []Highlight{
+				{Field: "text", Spans: []Span{{Start: 12, End: 21}}},
+			},
+		},
+		{
+			name: "attachments",
+			highlight: elastic.SearchHitHighlight{
+				"attachments.text": {"\ue000deploy\ue001 failed", "deploy \ue000failed\ue001"},
+			},
+			expected: []Highlight{
+				{Field: "attachments.text", Index: index(1), Spans: []Span{{Start: 0, End: 6}}},
+				{Field: "attachments.text", Index: index(2), Spans: []Span{{Start: 7, End: 13}}},
+			},
+		},
+		{
+			name: "unknown attachment",
+			highlight: elastic.SearchHitHighlight{
+				"attachments.text": {"\ue000tests\ue001 failed"},
+			},
+			expected: []Highlight{},
+		},
+	}
+
+	for _, test := range tests {
+		hit := &elastic.SearchHit{Highlight: test.highlight}
+
+		if actual := highlights(hit, message, "nl"); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package api
+
+import (
+	"reflect"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+	utils "github.com/dutchcoders/slackarchive/utils"
+)
+
+// activeHolds returns the holds of team that have not been released.
+func activeHolds(db *database, team string) (models.Holds, error) {
+	holds := models.Holds{}
+	if err := db.Holds.Find(bson.M{
+		"team": team,
+		"released_at": bson.M{
+			"$exists": false,
+		},
+	}).All(&holds); err != nil {
+		return nil, err
+	}
+
+	return holds, nil
+}
+
+// preserve saves the archived version of message if it is under hold and
+// is about to be changed or deleted.
+func (api *api) preserve(db *database, message *models.Message) error {
+	existing := models.Message{}
+	if err := db.Messages.FindId(message.ID).One(&existing); err == mgo.ErrNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	current := existing
+	if err := api.decrypt(&current); err != nil {
+		return err
+	}
+
+	if current.Text == message.Text &&
+		current.IsDeleted == message.IsDeleted &&
+		reflect.DeepEqual(current.Attachments, message.Attachments) &&
+		reflect.DeepEqual(current.File, message.File) {
+		return nil
+	}
+
+	holds, err := activeHolds(db, existing.Team)
+	if err != nil {
+		return err
+	}
+
+	ids := holds.Covers(&existing)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return db.Preserved.Insert(&models.PreservedMessage{
+		ID:          utils.NewUUID().String(),
+		Holds:       ids,
+		Message:     existing,
+		PreservedAt: time.Now(),
+	})
+}
+
+func (api *api) holdsHandler(ctx *Context) error {
+	response := struct {
+		Holds      []models.Hold `json:"holds"`
+		NextCursor string        `json:"next_cursor,omitempty"`
+	}{
+		Holds: []models.Hold{},
+	}
+
+	qry := bson.M{}
+	if team := ctx.r.FormValue("team"); team != "" {
+		qry["team"] = team
+	}
+
+	if ctx.r.FormValue("active") == "1" {
+		qry["released_at"] = bson.M{"$exists": false}
+	}
+
+	size, err := pageSize(ctx, 100, 1000)
+	if err != nil {
+		return err
+	}
+
+	if cursor := ctx.r.FormValue("cursor"); cursor != "" {
+		createdAt, id, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return err
+		}
+
+		// holds created before the last one, or at the same time with a
+		// larger id
+		qry["$or"] = []bson.M{
+			bson.M{"created_at": bson.M{"$lt": createdAt}},
+			bson.M{"created_at": createdAt, "_id": bson.M{"$gt": id}},
+		}
+	}
+
+	if err := ctx.db.Holds.Find(qry).Sort("-created_at", "_id").Limit(size).All(&response.Holds); err != nil {
+		return err
+	}
+
+	if len(response.Holds) == size {
+		last := response.Holds[size-1]
+		response.NextCursor = encodeTimeCursor(last.CreatedAt, last.ID)
+	}
+
+	return ctx.Write(response)
+}
+
+func (api *api) holdHandler(ctx *Context) error {
+	hold := models.Hold{}
+	if err := ctx.db.Holds.FindId(ctx.Vars["id"]).One(&hold); err == mgo.ErrNotFound {
+		return ErrHoldNotFound
+	} else if err != nil {
+		return err
+	}
+
+	return ctx.Write(hold)
+}
+
+func (api *api) createHoldHandler(ctx *Context) error {
+	hold := models.Hold{}
+	if err := ctx.Read(&hold); err != nil {
+		return err
+	}
+
+	verr := &errors.ValidationError{}
+	if hold.Team == "" {
+		verr.Add("team", "required", "Team is required")
+	}
+
+	if hold.Reason == "" {
+		verr.Add("reason", "required", "Reason is required")
+	}
+
+	if hold.CreatedBy == "" {
+		verr.Add("created_by", "required", "Creator is required")
+	}
+
+	if hold.From != nil && hold.To != nil && !hold.From.Before(*hold.To) {
+		verr.Add("to", "invalid", "To should be after from")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	hold.ID = utils.NewUUID().String()
+	hold.CreatedAt = time.Now()
+	hold.ReleasedAt = nil
+	hold.ReleasedBy = ""
+
+	if err := ctx.db.Holds.Insert(&hold); err != nil {
+		return err
+	}
+
+	log.Infof("Legal hold %s created by %s for team %s: %s", hold.ID, hold.CreatedBy, hold.Team, hold.Reason)
+
+	return ctx.Write(hold)
+}
+
+func (api *api) releaseHoldHandler(ctx *Context) error {
+	request := struct {
+		ReleasedBy string `json:"released_by"`
+	}{}
+
+	if err := ctx.Read(&request); err != nil {
+		return err
+	}
+
+	verr := &errors.ValidationError{}
+	if request.ReleasedBy == "" {
+		verr.Add("released_by", "required", "Releaser is required")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	hold := models.Hold{}
+	if err := ctx.db.Holds.FindId(ctx.Vars["id"]).One(&hold); err == mgo.ErrNotFound {
+		return ErrHoldNotFound
+	} else if err != nil {
+		return err
+	} else if hold.ReleasedAt != nil {
+		return ErrHoldReleased
+	}
+
+	now := time.Now()
+
+	hold.ReleasedBy = request.ReleasedBy
+	hold.ReleasedAt = &now
+
+	if err := ctx.db.Holds.UpdateId(hold.ID, &hold); err != nil {
+		return err
+	}
+
+	log.Infof("Legal hold %s released by %s", hold.ID, hold.ReleasedBy)
+
+	return ctx.Write(hold)
+}
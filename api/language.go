@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	mgo "gopkg.in/mgo.v2"
+
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+// analyzers contains the elasticsearch analyzer per supported language.
+var analyzers = map[string]string{
+	"da": "danish",
+	"de": "german",
+	"en": "english",
+	"es": "spanish",
+	"fr": "french",
+	"it": "italian",
+	"nl": "dutch",
+	"no": "norwegian",
+	"pt": "portuguese",
+	"sv": "swedish",
+}
+
+// stopwords contains the most frequent words of the languages that can be
+// detected.
+var stopwords = map[string][]string{
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "sie", "es", "ein", "eine", "zu", "mit", "auf", "für", "den", "dem", "wir", "auch", "aber", "noch", "wie", "oder"},
+	"en": {"the", "and", "is", "are", "was", "to", "of", "in", "that", "it", "for", "you", "with", "on", "this", "have", "be", "not", "but", "what", "just", "we"},
+	"es": {"el", "la", "los", "las", "y", "es", "un", "una", "que", "de", "en", "no", "por", "con", "para", "se", "lo", "como", "pero", "muy"},
+	"fr": {"le", "la", "les", "et", "est", "un", "une", "des", "pas", "je", "que", "qui", "dans", "pour", "sur", "avec", "ce", "il", "nous", "vous", "mais"},
+	"nl": {"de", "het", "een", "en", "is", "van", "ik", "te", "dat", "die", "niet", "zijn", "op", "met", "voor", "maar", "wat", "ook", "er", "je", "we", "nog"},
+}
+
+var stopwordLanguages = map[string][]string{}
+
+func init() {
+	for lang, words := range stopwords {
+		for _, word := range words {
+			stopwordLanguages[word] = append(stopwordLanguages[word], lang)
+		}
+	}
+}
+
+// detectLanguage returns the language of text by counting stopwords, or an
+// empty string if there is no clear winner.
+func detectLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+
+	counts := map[string]int{}
+	for _, word := range words {
+		for _, lang := range stopwordLanguages[word] {
+			counts[lang]++
+		}
+	}
+
+	best, first, second := "", 0, 0
+	for lang, count := range counts {
+		if count > first {
+			best, first, second = lang, count, first
+		} else if count > second {
+			second = count
+		}
+	}
+
+	if first < 2 || first == second {
+		return ""
+	}
+
+	return best
+}
+
+// languageField returns the field containing the text analyzed for lang.
+func languageField(lang string) string {
+	return fmt.Sprintf("text_%s", lang)
+}
+
+// teamSettings returns the search settings of team.
+func teamSettings(db *database, team string) (*models.TeamSettings, error) {
+	settings := models.TeamSettings{}
+	if err := db.Settings.FindId(team).One(&settings); err == mgo.ErrNotFound {
+		return &models.TeamSettings{Team: team}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &settings, nil
+}
+
+// settingsTTL is the time the search settings of a team are cached for
+// indexing.
+const settingsTTL = time.Minute
+
+type settingsEntry struct {
+	settings *models.TeamSettings
+	expires  time.Time
+}
+
+// settingsCache caches the search settings per team for settingsTTL, so
+// they aren't queried for every indexed message. Updating the settings of a
+// team removes its entry.
+type settingsCache struct {
+	sync.Mutex
+
+	entries map[string]settingsEntry
+}
+
+func (c *settingsCache) get(db *database, team string) (*models.TeamSettings, error) {
+	c.Lock()
+	entry, ok := c.entries[team]
+	c.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.settings, nil
+	}
+
+	settings, err := teamSettings(db, team)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if c.entries == nil {
+		c.entries = map[string]settingsEntry{}
+	}
+
+	c.entries[team] = settingsEntry{
+		settings: settings,
+		expires:  time.Now().Add(settingsTTL),
+	}
+
+	return settings, nil
+}
+
+func (c *settingsCache) remove(team string) {
+	c.Lock()
+	defer c.Unlock()
+
+	delete(c.entries, team)
+}
+
+// searchLanguages returns the languages the messages of a team with
+// settings can be indexed with.
+func searchLanguages(settings *models.TeamSettings) []string {
+	languages := []string{}
+	if settings.Language != "" {
+		languages = append(languages, settings.Language)
+	}
+
+	if !settings.DetectLanguage {
+		return languages
+	}
+
+	for lang := range stopwords {
+		if lang != settings.Language {
+			languages = append(languages, lang)
+		}
+	}
+
+	sort.Strings(languages)
+	return languages
+}
+
+// document returns message as it is indexed, including the text analyzed
+// for its language.
+func (api *api) document(db *database, message *models.Message) (map[string]interface{}, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	doc["links"] = messageLinks(message)
+
+	if mentions := messageMentions(message); !mentions.empty() {
+		doc["mentions"] = mentions
+	}
+
+	if code := extractCode(message.Text); len(code) > 0 {
+		doc[codeField] = code
+	}
+
+	settings, err := api.settings.get(db, message.Team)
+	if err != nil {
+		return nil, err
+	}
+
+	lang := settings.Language
+	if !settings.DetectLanguage {
+	} else if detected := detectLanguage(message.Text); detected != "" {
+		lang = detected
+	}
+
+	if lang == "" || message.Text == "" {
+		return doc, nil
+	}
+
+	doc["language"] = lang
+	doc[languageField(lang)] = message.Text
+	return doc, nil
+}
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// Link is a url shared in a message, in its text or one of its attachments.
+// Shares is the number of times the url has been shared, and is only set
+// when links are deduplicated.
+type Link struct {
+	URL       string `json:"url"`
+	Domain    string `json:"domain"`
+	Title     string `json:"title,omitempty"`
+	User      string `json:"user,omitempty"`
+	Channel   string `json:"channel"`
+	Timestamp string `json:"ts"`
+	Message   string `json:"message"`
+
+	Shares int64 `json:"shares,omitempty"`
+}
+
+// linkRe matches links in the text of a message, formatted as <url> or
+// <url|label>.
+var linkRe = regexp.MustCompile(`<(https?://[^|>]+)(?:\|([^>]*))?>`)
+
+// linksMapping returns the mapping of the links of a message, which are
+// nested so every link can be filtered and aggregated on its own.
+func linksMapping(timestamp map[string]interface{}) map[string]interface{} {
+	keyword := map[string]interface{}{
+		"type": "keyword",
+	}
+
+	return map[string]interface{}{
+		"type": "nested",
+		"properties": map[string]interface{}{
+			"url":    keyword,
+			"domain": keyword,
+			"title": map[string]interface{}{
+				"type": "text",
+			},
+			"user":    keyword,
+			"channel": keyword,
+			"ts":      timestamp,
+			"message": keyword,
+		},
+	}
+}
+
+// linkDomain returns the lowercase host of u without www, or an empty
+// string if u isn't a http or https url.
+func linkDomain(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return ""
+	}
+
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+// messageLinks returns the links in the text and attachments of message,
+// every url only once. Titles are taken from the attachments unfurling a
+// link, or the label of the link in the text.
+func messageLinks(message *models.Message) []Link {
+	links := []Link{}
+	index := map[string]int{}
+
+	add := func(u, title string) {
+		domain := linkDomain(u)
+		if domain == "" {
+			return
+		}
+
+		if i, ok := index[u]; !ok {
+		} else if links[i].Title == "" {
+			links[i].Title = title
+			return
+		} else {
+			return
+		}
+
+		index[u] = len(links)
+		links = append(links, Link{
+			URL:       u,
+			Domain:    domain,
+			Title:     title,
+			User:      message.User,
+			Channel:   message.Channel,
+			Timestamp: message.Timestamp,
+			Message:   message.ID,
+		})
+	}
+
+	for _, matches := range linkRe.FindAllStringSubmatch(message.Text, -1) {
+		// slack escapes &, < and > in the text, but not in attachments
+		u, title := html.UnescapeString(matches[1]), html.UnescapeString(matches[2])
+		if strings.Contains(strings.ToLower(u), strings.ToLower(title)) {
+			// slack labels links with the url itself
+			title = ""
+		}
+
+		add(u, title)
+	}
+
+	for _, attachment := range message.Attachments {
+		add(attachment.TitleLink, attachment.Title)
+		add(attachment.AuthorLink, attachment.AuthorName)
+		add(attachment.ImageURL, "")
+	}
+
+	return links
+}
+
+// linksHandler returns the links shared in the channels of the team, most
+// recent first. With dedupe=1 every url is returned once, with the number of
+// times it has been shared, and there is no next page. The domains facet
+// contains the number of links per domain, regardless of the domain filter.
+func (api *api) linksHandler(ctx *Context) error {
+	response := struct {
+		Links      []Link        `json:"links"`
+		TotalCount int64         `json:"total"`
+		NextCursor string        `json:"next_cursor,omitempty"`
+		Domains    []FacetBucket `json:"domains"`
+	}{
+		Links:   []Link{},
+		Domains: []FacetBucket{},
+	}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	size, err := pageSize(ctx, 50, 500)
+	if err != nil {
+		return err
+	}
+
+	channels, err := visibleChannels(ctx.db, team.ID, ctx.r.FormValue("channel"))
+	if err != nil {
+		return err
+	}
+
+	fq := messagesFilter(team.ID).
+		Filter(elastic.NewTermsQuery("channel.raw", channels...))
+
+	if val := ctx.r.FormValue("user"); val != "" {
+		fq = fq.Filter(elastic.NewTermQuery("user.raw", val))
+	}
+
+	from := float64(0)
+	if val, err := strconv.ParseFloat(ctx.r.FormValue("from"), 64); err == nil {
+		from = val
+	}
+
+	to := float64(time.Now().Unix())
+	if val, err := strconv.ParseFloat(ctx.r.FormValue("to"), 64); err == nil {
+		to = val
+	}
+
+	fq = fq.Filter(elastic.NewRangeQuery("ts.float").Gte(from).Lt(to))
+
+	var lq elastic.Query = elastic.NewExistsQuery("links.url")
+	if domain := strings.ToLower(ctx.r.FormValue("domain")); domain != "" {
+		lq = elastic.NewTermQuery("links.domain", strings.TrimPrefix(domain, "www."))
+	}
+
+	dedupe := ctx.r.FormValue("dedupe") == "1"
+	cursor := ctx.r.FormValue("cursor")
+
+	// deduplicated urls are aggregated and can't be paginated
+	verr := &errors.ValidationError{}
+	if dedupe && cursor != "" {
+		verr.Add("cursor", "invalid", "Cursor can't be combined with dedupe")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	nq := elastic.NewNestedQuery("links", lq)
+	if !dedupe {
+		nq = nq.InnerHit(elastic.NewInnerHit().Name("links").Size(100))
+	}
+
+	domainsAgg := elastic.NewGlobalAggregation().
+		SubAggregation("selected", elastic.NewFilterAggregation().
+			Filter(fq).
+			SubAggregation("links", elastic.NewNestedAggregation().
+				Path("links").
+				SubAggregation("domains", elastic.NewTermsAggregation().
+					Field("links.domain").
+					Size(50).
+					OrderByCountDesc())))
+
+	ss := elastic.NewSearchSource().
+		Query(elastic.NewBoolQuery().Filter(fq, nq)).
+		Aggregation("domains", domainsAgg)
+
+	if dedupe {
+		// the urls are ordered by the last time they have been shared, with
+		// the last share as top hit
+		urlsAgg := elastic.NewTermsAggregation().
+			Field("links.url").
+			Size(size).
+			Order("latest", false).
+			SubAggregation("latest", elastic.NewMaxAggregation().Field("links.ts.float")).
+			SubAggregation("share", elastic.NewTopHitsAggregation().Sort("links.ts.float", false).Size(1))
+
+		ss = ss.Size(0).
+			Aggregation("links", elastic.NewNestedAggregation().
+				Path("links").
+				SubAggregation("selected", elastic.NewFilterAggregation().
+					Filter(lq).
+					SubAggregation("urls", urlsAgg).
+					SubAggregation("unique", elastic.NewCardinalityAggregation().Field("links.url"))))
+	} else {
+		ss = ss.Sort("ts.float", false).
+			Sort("id.raw", false).
+			Size(size)
+
+		if cursor == "" {
+		} else if values, err := decodeCursor(cursor, 2); err != nil {
+			return err
+		} else {
+			ss = ss.SearchAfter(values...)
+		}
+	}
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	if global, ok := searchResult.Aggregations.Global("domains"); !ok {
+	} else if selected, ok := global.Filter("selected"); !ok {
+	} else if links, ok := selected.Nested("links"); !ok {
+	} else if domains, ok := links.Terms("domains"); ok {
+		for _, bucket := range domains.Buckets {
+			response.Domains = append(response.Domains, FacetBucket{
+				Key:   bucket.Key.(string),
+				Count: bucket.DocCount,
+			})
+		}
+	}
+
+	if !dedupe {
+		response.TotalCount = searchResult.Hits.TotalHits
+
+		for _, hit := range searchResult.Hits.Hits {
+			inner, ok := hit.InnerHits["links"]
+			if !ok || inner.Hits == nil {
+				continue
+			}
+
+			for _, linkHit := range inner.Hits.Hits {
+				link := Link{}
+				if err := json.Unmarshal(*linkHit.Source, &link); err != nil {
+					log.Error(err.Error())
+					continue
+				}
+
+				response.Links = append(response.Links, link)
+			}
+		}
+
+		if hits := searchResult.Hits.Hits; len(hits) == size {
+			response.NextCursor = encodeCursor(hits[len(hits)-1].Sort...)
+		}
+
+		return ctx.Write(response)
+	}
+
+	if links, ok := searchResult.Aggregations.Nested("links"); !ok {
+	} else if selected, ok := links.Filter("selected"); !ok {
+	} else {
+		if unique, ok := selected.Cardinality("unique"); ok && unique.Value != nil {
+			response.TotalCount = int64(*unique.Value)
+		}
+
+		urls, ok := selected.Terms("urls")
+		if !ok {
+			return ctx.Write(response)
+		}
+
+		for _, bucket := range urls.Buckets {
+			share, ok := bucket.TopHits("share")
+			if !ok || share.Hits == nil || len(share.Hits.Hits) == 0 {
+				continue
+			}
+
+			link := Link{}
+			if err := json.Unmarshal(*share.Hits.Hits[0].Source, &link); err != nil {
+				log.Error(err.Error())
+				continue
+			}
+
+			link.Shares = bucket.DocCount
+			response.Links = append(response.Links, link)
+		}
+	}
+
+	return ctx.Write(response)
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+func TestLinkDomain(t *testing.T) {
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://www.Example.com/path", "example.com"},
+		{"http://docs.example.com:8080/", "docs.example.com"},
+		{"ftp://example.com/file", ""},
+		{"mailto:alice@example.com", ""},
+		{"://invalid", ""},
+	}
+
+	for _, test := range tests {
+		if actual := linkDomain(test.url); actual != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.url, test.expected, actual)
+		}
+	}
+}
+
+func TestMessageLinks(t *testing.T) {
+	link := func(url, domain, title string) Link {
+		return Link{
+			URL:       url,
+			Domain:    domain,
+			Title:     title,
+			User:      "U1",
+			Channel:   "C1",
+			Timestamp: "1500000000.000100",
+			Message:   "T1-C1-1500000000.000100",
+		}
+	}
+
+	tests := []struct {
+		name        string
+		text        string
+		attachments []models.Attachment
+		expected    []Link
+	}{
+		{
+			name:     "no links",
+			text:     "hello <@U2>",
+			expected: []Link{},
+		},
+		{
+			name: "labels",
+			text: "see <https://example.com/a|the docs> and <https://www.example.com/b> or <http://EXAMPLE.com/c|example.com/c>",
+			expected: []Link{
+				link("https://example.com/a", "example.com", "the docs"),
+				link("https://www.example.com/b", "example.com", ""),
+				link("http://EXAMPLE.com/c", "example.com", ""),
+			},
+		},
+		{
+			name: "escaped",
+			text: "<https://example.com/search?q=a&amp;page=2|results &lt;2&gt;>",
+			attachments: []models.Attachment{
+				{
+					Title:     "Search",
+					TitleLink: "https://example.com/search?q=a&page=2",
+				},
+			},
+			expected: []Link{
+				link("https://example.com/search?q=a&page=2", "example.com", "results <2>"),
+			},
+		},
+		{
+			name:     "not http",
+			text:     "<mailto:alice@example.com|alice> <slack://channel?id=C1>",
+			expected: []Link{},
+		},
+		{
+			name: "duplicates take the title of the attachment",
+			text: "<https://example.com/a> <https://example.com/a>",
+			attachments: []models.Attachment{
+				{
+					Title:     "Example",
+					TitleLink: "https://example.com/a",
+					ImageURL:  "https://img.example.org/a.png",
+				},
+			},
+			expected: []Link{
+				link("https://example.com/a", "example.com", "Example"),
+				link("https://img.example.org/a.png", "img.example.org", ""),
+			},
+		},
+	}
+
+	for _, test := range tests {
+		message := models.Message{
+			ID:          "T1-C1-1500000000.000100",
+			Channel:     "C1",
+			User:        "U1",
+			Timestamp:   "1500000000.000100",
+			Text:        test.text,
+			Attachments: test.attachments,
+		}
+
+		if actual := messageLinks(&message); !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// messagesMapping returns the mapping of the messages index. Strings are
+// analyzed and have a raw keyword field for filtering, timestamps have a
+// float field for sorting and ranges, every supported language has its own
+// analyzed text field and the links shared are nested records.
+func messagesMapping() map[string]interface{} {
+	timestamp := map[string]interface{}{
+		"type": "text",
+		"fields": map[string]interface{}{
+			"raw": map[string]interface{}{
+				"type": "keyword",
+			},
+			"float": map[string]interface{}{
+				"type": "double",
+			},
+		},
+	}
+
+	properties := map[string]interface{}{
+		"ts":        timestamp,
+		"thread_ts": timestamp,
+		"language": map[string]interface{}{
+			"type": "keyword",
+		},
+		"links":    linksMapping(timestamp),
+		"mentions": mentionsMapping(),
+		codeField: map[string]interface{}{
+			"type":     "text",
+			"analyzer": "code",
+		},
+	}
+
+	for lang, analyzer := range analyzers {
+		properties[languageField(lang)] = map[string]interface{}{
+			"type":     "text",
+			"analyzer": analyzer,
+		}
+	}
+
+	return map[string]interface{}{
+		"dynamic_templates": []interface{}{
+			map[string]interface{}{
+				"strings": map[string]interface{}{
+					"match_mapping_type": "string",
+					"mapping": map[string]interface{}{
+						"type": "text",
+						"fields": map[string]interface{}{
+							"raw": map[string]interface{}{
+								"type":         "keyword",
+								"ignore_above": 256,
+							},
+						},
+					},
+				},
+			},
+		},
+		"properties": properties,
+	}
+}
+
+// missingAnalyzerRe matches the reasons Elasticsearch 5 and 7 give for a
+// mapping referring to an analyzer that doesn't exist.
+var missingAnalyzerRe = regexp.MustCompile(`analyzer \[[^\]]*\] (not found|has not been configured)`)
+
+// missingAnalyzer returns true if err is returned for a mapping using an
+// analyzer that isn't part of the settings of the index, other errors like
+// conflicting field types are not solved by updating the analysis.
+func missingAnalyzer(err error) bool {
+	ee, ok := err.(*elastic.Error)
+	if !ok || ee.Status != http.StatusBadRequest || ee.Details == nil {
+		return false
+	}
+
+	for _, details := range append([]*elastic.ErrorDetails{ee.Details}, ee.Details.RootCause...) {
+		if details != nil && details.Type == "mapper_parsing_exception" && missingAnalyzerRe.MatchString(details.Reason) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EnsureIndex creates the messages and autocomplete indexes, or updates their
+// mappings.
+func (api *api) EnsureIndex() error {
+	session := api.session.Copy()
+	defer session.Close()
+
+	analysis, err := vocabularyAnalysis(Database(session))
+	if err != nil {
+		return err
+	}
+
+	settings := map[string]interface{}{
+		"analysis": analysis,
+	}
+
+	err = api.es.EnsureIndex(context.Background(), messagesIndex, settings, messagesMapping())
+	if missingAnalyzer(err) {
+		// the mapping uses analyzers added after the index has been created,
+		// the index is closed while they are added
+		if err := api.es.UpdateAnalysis(context.Background(), messagesIndex, analysis); err != nil {
+			return err
+		}
+
+		err = api.es.EnsureIndex(context.Background(), messagesIndex, settings, messagesMapping())
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return api.es.EnsureIndex(context.Background(), autocompleteIndex, autocompleteSettings(), autocompleteMapping())
+}
@@ -0,0 +1,60 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+func TestMissingAnalyzer(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"nil", nil, false},
+		{"other error", fmt.Errorf("connection refused"), false},
+		{"elasticsearch 5", &elastic.Error{
+			Status: http.StatusBadRequest,
+			Details: &elastic.ErrorDetails{
+				Type:   "mapper_parsing_exception",
+				Reason: "analyzer [code] not found for field [code]",
+			},
+		}, true},
+		{"elasticsearch 7 root cause", &elastic.Error{
+			Status: http.StatusBadRequest,
+			Details: &elastic.ErrorDetails{
+				Type:   "mapper_parsing_exception",
+				Reason: "Failed to parse mapping: analyzer [code] has not been configured in mappings",
+				RootCause: []*elastic.ErrorDetails{
+					{
+						Type:   "mapper_parsing_exception",
+						Reason: "analyzer [code] has not been configured in mappings",
+					},
+				},
+			},
+		}, true},
+		{"conflicting type", &elastic.Error{
+			Status: http.StatusBadRequest,
+			Details: &elastic.ErrorDetails{
+				Type:   "illegal_argument_exception",
+				Reason: "mapper [ts] cannot be changed from type [text] to [long]",
+			},
+		}, false},
+		{"not found", &elastic.Error{
+			Status: http.StatusNotFound,
+			Details: &elastic.ErrorDetails{
+				Type:   "index_not_found_exception",
+				Reason: "no such index",
+			},
+		}, false},
+	}
+
+	for _, test := range tests {
+		if actual := missingAnalyzer(test.err); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package api
+
+import (
+	"context"
+	"regexp"
+	"time"
+
+	"github.com/nlopes/slack"
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+var (
+	userMentionRe      = regexp.MustCompile(`<@([UW][A-Z0-9]+)(\|[^>]*)?>`)
+	groupMentionRe     = regexp.MustCompile(`<!subteam\^([A-Z0-9]+)(\|[^>]*)?>`)
+	broadcastMentionRe = regexp.MustCompile(`<!(channel|here|everyone)(\|[^>]*)?>`)
+)
+
+// Mentions contains the users, user groups and broadcasts (channel, here or
+// everyone) mentioned in a message.
+type Mentions struct {
+	Users     []string `json:"users,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	Broadcast []string `json:"broadcast,omitempty"`
+}
+
+func (m Mentions) empty() bool {
+	return len(m.Users) == 0 && len(m.Groups) == 0 && len(m.Broadcast) == 0
+}
+
+func mentionsMapping() map[string]interface{} {
+	keyword := map[string]interface{}{
+		"type": "keyword",
+	}
+
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			"users":     keyword,
+			"groups":    keyword,
+			"broadcast": keyword,
+		},
+	}
+}
+
+// messageMentions returns the mentions in the text of message.
+func messageMentions(message *models.Message) Mentions {
+	mentions := Mentions{}
+
+	submatches := func(re *regexp.Regexp) []string {
+		values := []string{}
+		seen := map[string]bool{}
+
+		for _, matches := range re.FindAllStringSubmatch(message.Text, -1) {
+			if seen[matches[1]] {
+				continue
+			}
+
+			seen[matches[1]] = true
+			values = append(values, matches[1])
+		}
+
+		return values
+	}
+
+	mentions.Users = submatches(userMentionRe)
+	mentions.Groups = submatches(groupMentionRe)
+	mentions.Broadcast = submatches(broadcastMentionRe)
+	return mentions
+}
+
+// saveUserGroup stores a user group received from the bot or Slack.
+func saveUserGroup(db *database, group *models.UserGroup) error {
+	_, err := db.UserGroups.UpsertId(group.ID, group)
+	return err
+}
+
+// userGroupsInterval is the interval the user groups of all teams are
+// synchronized with Slack.
+const userGroupsInterval = time.Hour
+
+func (api *api) userGroupSyncer() {
+	ticker := time.NewTicker(userGroupsInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := api.syncUserGroups(); err != nil {
+			log.Errorf("Error synchronizing user groups: %s", err.Error())
+		}
+
+		<-ticker.C
+	}
+}
+
+// syncUserGroups fetches the user groups and their members of every team
+// with a token from Slack, and removes the user groups that no longer exist.
+// Teams whose token can't list user groups keep the groups received from
+// the bot.
+func (api *api) syncUserGroups() error {
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	teams := []models.Team{}
+	if err := db.Teams.Find(bson.M{
+		"is_disabled": bson.M{
+			"$not": bson.M{"$eq": true},
+		},
+		"token": bson.M{"$nin": []interface{}{nil, ""}},
+	}).All(&teams); err != nil {
+		return err
+	}
+
+	for _, team := range teams {
+		if err := syncTeamUserGroups(db, slack.New(team.Token), team.ID); err != nil {
+			log.Warningf("Error synchronizing user groups of team %s: %s", team.ID, err.Error())
+		}
+	}
+
+	return nil
+}
+
+func syncTeamUserGroups(db *database, client *slack.Client, team string) error {
+	groups, err := client.GetUserGroups()
+	if err != nil {
+		return err
+	}
+
+	ids := []string{}
+	for _, group := range groups {
+		if group.DateDelete != 0 {
+			continue
+		}
+
+		users, err := client.GetUserGroupMembers(group.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := saveUserGroup(db, &models.UserGroup{
+			ID:          group.ID,
+			Team:        team,
+			Name:        group.Name,
+			Handle:      group.Handle,
+			Description: group.Description,
+			Users:       users,
+		}); err != nil {
+			return err
+		}
+
+		ids = append(ids, group.ID)
+	}
+
+	_, err = db.UserGroups.RemoveAll(bson.M{
+		"team": team,
+		"_id":  bson.M{"$nin": ids},
+	})
+	return err
+}
+
+// mentionsQuery matches the messages mentioning one of the users with ids of
+// team, or one of their user groups.
+func mentionsQuery(db *database, team string, ids []interface{}) (*elastic.BoolQuery, error) {
+	groups := []interface{}{}
+	if err := db.UserGroups.Find(bson.M{
+		"team":  team,
+		"users": bson.M{"$in": ids},
+	}).Distinct("_id", &groups); err != nil {
+		return nil, err
+	}
+
+	mq := elastic.NewBoolQuery().
+		MinimumShouldMatch("1").
+		Should(elastic.NewTermsQuery("mentions.users", ids...))
+
+	if len(groups) > 0 {
+		mq = mq.Should(elastic.NewTermsQuery("mentions.groups", groups...))
+	}
+
+	return mq, nil
+}
+
+// mentionsHandler returns the messages mentioning a user or one of the user
+// groups they belong to, newest first. With broadcast=1 messages mentioning
+// @channel, @here or @everyone in channels the user is a member of are
+// included as well. Messages of the user themselves are left out.
+func (api *api) mentionsHandler(ctx *Context) error {
+	response := struct {
+		Messages   []MessageResponse `json:"messages"`
+		TotalCount int64             `json:"total"`
+		NextCursor string            `json:"next_cursor,omitempty"`
+		Related    struct {
+			Users map[string]UserResponse `json:"users"`
+		} `json:"related"`
+	}{
+		Messages: []MessageResponse{},
+	}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	id := ctx.r.FormValue("user")
+
+	verr := &errors.ValidationError{}
+	if id == "" {
+		verr.Add("user", "required", "User is required")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	user, err := teamUser(ctx.db, team.ID, id)
+	if err != nil {
+		return err
+	}
+
+	size, err := pageSize(ctx, 50, 500)
+	if err != nil {
+		return err
+	}
+
+	mq, err := mentionsQuery(ctx.db, team.ID, []interface{}{user.ID})
+	if err != nil {
+		return err
+	}
+
+	if ctx.r.FormValue("broadcast") == "1" {
+		channels := []interface{}{}
+		if err := ctx.db.Channels.Find(bson.M{
+			"team":    team.ID,
+			"members": user.ID,
+		}).Distinct("_id", &channels); err != nil {
+			return err
+		}
+
+		if len(channels) > 0 {
+			mq = mq.Should(elastic.NewBoolQuery().Filter(
+				elastic.NewExistsQuery("mentions.broadcast"),
+				elastic.NewTermsQuery("channel.raw", channels...),
+			))
+		}
+	}
+
+	channels, err := visibleChannels(ctx.db, team.ID, ctx.r.FormValue("channel"))
+	if err != nil {
+		return err
+	}
+
+	q := messagesFilter(team.ID).
+		Filter(
+			elastic.NewTermsQuery("channel.raw", channels...),
+			elastic.NewRangeQuery("ts.float").Lt(time.Now().Unix()),
+			mq,
+		).
+		MustNot(elastic.NewTermQuery("user.raw", user.ID))
+
+	ss := elastic.NewSearchSource().
+		Query(q).
+		Sort("ts.float", false).
+		Sort("id.raw", false).
+		Size(size)
+
+	if cursor := ctx.r.FormValue("cursor"); cursor == "" {
+	} else if values, err := decodeCursor(cursor, 2); err != nil {
+		return err
+	} else {
+		ss = ss.SearchAfter(values...)
+	}
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	response.TotalCount = searchResult.Hits.TotalHits
+
+	for _, hit := range searchResult.Hits.Hits {
+		msg, err := messageFromHit(hit)
+		if err != nil {
+			continue
+		}
+
+		response.Messages = append(response.Messages, *msg)
+	}
+
+	if hits := searchResult.Hits.Hits; len(hits) == size {
+		response.NextCursor = encodeCursor(hits[len(hits)-1].Sort...)
+	}
+
+	users, err := relatedUsers(ctx.db, response.Messages)
+	if err != nil {
+		return err
+	}
+
+	response.Related.Users = users
+
+	return ctx.Write(response)
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+func TestMessageMentions(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected Mentions
+	}{
+		{"no mentions", Mentions{Users: []string{}, Groups: []string{}, Broadcast: []string{}}},
+		{
+			"<@U0123> and <@W0456|bob>, again <@U0123>",
+			Mentions{Users: []string{"U0123", "W0456"}, Groups: []string{}, Broadcast: []string{}},
+		},
+		{
+			"<!subteam^S0123|@oncall> <!here> <!channel|@channel>",
+			Mentions{Users: []string{}, Groups: []string{"S0123"}, Broadcast: []string{"here", "channel"}},
+		},
+		{
+			"<#C0123|general> <@lowercase> <!everyone>",
+			Mentions{Users: []string{}, Groups: []string{}, Broadcast: []string{"everyone"}},
+		},
+	}
+
+	for _, test := range tests {
+		actual := messageMentions(&models.Message{Text: test.text})
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%q: expected %+v, got %+v", test.text, test.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	models "github.com/dutchcoders/slackarchive/models"
+	utils "github.com/dutchcoders/slackarchive/utils"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// MessageResponse is a message as returned by the api.
+type MessageResponse struct {
+	Text            string `json:"text"`
+	Channel         string `json:"channel"`
+	User            string `json:"user"`
+	Type            string `json:"type"`
+	Timestamp       string `json:"ts"`
+	ThreadTimestamp string `json:"thread_ts,omitempty"`
+
+	IsStarred   bool              `json:"is_starred,omitempty"`
+	PinnedTo    []string          `json:"pinned_to,omitempty"`
+	Attachments []Attachment      `json:"attachments,omitempty"`
+	Reactions   []models.Reaction `json:"reactions,omitempty"`
+	// Edited      *Edited      `json:"edited,omitempty"`
+
+	// Message Subtypes
+	SubType string `json:"subtype,omitempty"`
+
+	// Hidden Subtypes
+	Hidden           bool   `json:"hidden,omitempty"`     // message_changed, message_deleted, unpinned_item
+	DeletedTimestamp string `json:"deleted_ts,omitempty"` // message_deleted
+	EventTimestamp   string `json:"event_ts,omitempty"`
+
+	// bot_message (https://api.slack.com/events/message/bot_message)
+	BotID    string `json:"bot_id,omitempty"`
+	Username string `json:"username,omitempty"`
+
+	Icons struct {
+		IconURL   string `json:"icon_url,omitempty"`
+		IconEmoji string `json:"icon_emoji,omitempty"`
+	} `json:"icons,omitempty"`
+
+	// channel_join, group_join
+	Inviter string `json:"inviter,omitempty"`
+
+	// channel_topic, group_topic
+	Topic string `json:"topic,omitempty"`
+
+	// channel_purpose, group_purpose
+	Purpose string `json:"purpose,omitempty"`
+
+	// channel_name, group_name
+	Name    string `json:"name,omitempty"`
+	OldName string `json:"old_name,omitempty"`
+
+	// channel_archive, group_archive
+	Members []string `json:"members,omitempty"`
+
+	// file_share, file_comment, file_mention
+	File *FileResponse `json:"file,omitempty"`
+
+	// file_share
+	Upload bool `json:"upload,omitempty"`
+
+	// file_comment
+	// Comment *Comment `json:"comment,omitempty"`
+
+	// pinned_item
+	ItemType string `json:"item_type,omitempty"`
+
+	// https://api.slack.com/rtm
+	ReplyTo int    `json:"reply_to,omitempty"`
+	Team    string `json:"team,omitempty"`
+
+	// the spans that matched a search query
+	Highlights []Highlight `json:"highlights,omitempty"`
+}
+
+// FileResponse is the shared file of a message as returned by the api.
+type FileResponse struct {
+	ID         string `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Title      string `json:"title,omitempty"`
+	Filetype   string `json:"filetype,omitempty"`
+	PrettyType string `json:"pretty_type,omitempty"`
+	Permalink  string `json:"permalink,omitempty"`
+	Preview    string `json:"preview,omitempty"`
+}
+
+// newMessageResponse returns message as returned by the api.
+func newMessageResponse(message *models.Message) *MessageResponse {
+	msg := MessageResponse{}
+	if err := utils.Merge(&msg, *message); err != nil {
+		log.Error(err.Error())
+	}
+
+	if message.File != nil {
+		msg.File = &FileResponse{}
+		if err := utils.Merge(msg.File, *message.File); err != nil {
+			log.Error(err.Error())
+		}
+	}
+
+	return &msg
+}
+
+// visibleChannels returns the ids of the channels of team that are still
+// being archived, optionally limited to channel.
+func visibleChannels(db *database, team string, channel string) ([]interface{}, error) {
+	qry := bson.M{
+		"team":      team,
+		"is_member": true,
+	}
+
+	if channel != "" {
+		qry["_id"] = channel
+	}
+
+	channels := []models.Channel{}
+	if err := db.Channels.Find(qry).All(&channels); err != nil {
+		return nil, err
+	}
+
+	ids := []interface{}{}
+	for _, channel := range channels {
+		ids = append(ids, channel.ID)
+	}
+
+	return ids, nil
+}
+
+// messagesFilter filters the messages of team that are shown in search
+// results, leaving out edits, deletions and membership changes.
+func messagesFilter(team string) *elastic.BoolQuery {
+	return elastic.NewBoolQuery().
+		Must(elastic.NewTermsQuery("team.raw", team)).
+		MustNot(
+			elastic.NewTermQuery("sub_type.raw", "message_changed"),
+			elastic.NewTermQuery("sub_type.raw", "message_deleted"),
+			elastic.NewTermQuery("sub_type.raw", "channel_join"),
+			elastic.NewTermQuery("sub_type.raw", "channel_leave"),
+			elastic.NewTermQuery("sub_type.raw", "pinned_item"),
+			elastic.NewTermQuery("hidden", true),
+		)
+}
+
+// messageFromHit returns the message of a search hit, with the spans of its
+// fields that matched the query.
+func messageFromHit(hit *elastic.SearchHit) (*MessageResponse, error) {
+	var message struct {
+		models.Message
+
+		Language string `json:"language"`
+	}
+
+	if err := json.Unmarshal(*hit.Source, &message); err != nil {
+		return nil, err
+	}
+
+	msg := newMessageResponse(&message.Message)
+	msg.Highlights = highlights(hit, &message.Message, message.Language)
+
+	return msg, nil
+}
+
+var mentionRe = regexp.MustCompile(`\<\@(.+?)\>`)
+
+// relatedUsers returns the authors of messages and the users mentioned in
+// them.
+func relatedUsers(db *database, messages []MessageResponse) (map[string]UserResponse, error) {
+	userids := []string{}
+	for _, message := range messages {
+		// extract matches from message text
+		for _, match := range mentionRe.FindAllStringSubmatch(message.Text, -1) {
+			userids = append(userids, match[1])
+		}
+
+		if message.User == "" {
+			continue
+		}
+
+		userids = append(userids, message.User)
+	}
+
+	iter := db.Users.Find(
+		bson.M{
+			"_id": bson.M{
+				"$in": userids,
+			},
+		}).Iter()
+
+	defer iter.Close()
+
+	users := []models.User{}
+	if err := iter.All(&users); err != nil {
+		return nil, err
+	}
+
+	related := map[string]UserResponse{}
+	for _, user := range users {
+		usr := UserResponse{}
+		if err := utils.Merge(&usr, user); err != nil {
+			log.Error(err.Error())
+		}
+
+		related[user.ID] = usr
+	}
+
+	return related, nil
+}
+
+// message returns the decrypted message with id, if it belongs to team and
+// is in a channel that is still being archived.
+func (api *api) message(db *database, team string, id string) (*models.Message, error) {
+	message := models.Message{}
+	if err := db.Messages.FindId(id).One(&message); err == mgo.ErrNotFound {
+		return nil, ErrMessageNotFound
+	} else if err != nil {
+		return nil, err
+	} else if message.Team != team {
+		return nil, ErrMessageNotFound
+	}
+
+	if channels, err := visibleChannels(db, team, message.Channel); err != nil {
+		return nil, err
+	} else if len(channels) == 0 {
+		return nil, ErrMessageNotFound
+	}
+
+	if err := api.decrypt(&message); err != nil {
+		return nil, err
+	}
+
+	return &message, nil
+}
+
+// similarMessagesHandler returns past messages that discuss the same
+// subject as a message, using a more like this query on its text.
+func (api *api) similarMessagesHandler(ctx *Context) error {
+	response := struct {
+		Messages   []MessageResponse `json:"messages"`
+		TotalCount int64             `json:"total"`
+		Related    struct {
+			Users map[string]UserResponse `json:"users"`
+		} `json:"related"`
+	}{
+		Messages: []MessageResponse{},
+	}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	message, err := api.message(ctx.db, team.ID, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	like := []string{message.Text}
+	for _, attachment := range message.Attachments {
+		like = append(like, attachment.Title, attachment.Text)
+	}
+
+	channels, err := visibleChannels(ctx.db, team.ID, "")
+	if err != nil {
+		return err
+	}
+
+	size := 10
+	if val, err := strconv.Atoi(ctx.r.FormValue("size")); err == nil && val > 0 && val <= 50 {
+		size = val
+	}
+
+	mlt := elastic.NewMoreLikeThisQuery().
+		Field("text", "attachments.text", "attachments.title").
+		LikeText(like...).
+		MinTermFreq(1).
+		MinDocFreq(2).
+		MaxQueryTerms(25)
+
+	qs := elastic.NewBoolQuery().
+		Must(mlt).
+		Filter(
+			messagesFilter(team.ID),
+			elastic.NewTermsQuery("channel.raw", channels...),
+		).
+		MustNot(elastic.NewIdsQuery().Ids(message.ID))
+
+	ss := elastic.NewSearchSource().
+		Query(qs).
+		Size(size)
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	response.TotalCount = searchResult.Hits.TotalHits
+
+	for _, hit := range searchResult.Hits.Hits {
+		msg, err := messageFromHit(hit)
+		if err != nil {
+			continue
+		}
+
+		response.Messages = append(response.Messages, *msg)
+	}
+
+	users, err := relatedUsers(ctx.db, response.Messages)
+	if err != nil {
+		return err
+	}
+
+	response.Related.Users = users
+
+	return ctx.Write(response)
+}
+
+// contextMessages returns up to limit messages from scope before or after
+// ts, in chronological order.
+func (api *api) contextMessages(db *database, scope bson.M, ts string, after bool, limit int) ([]MessageResponse, error) {
+	qry := bson.M{
+		"subtype": bson.M{
+			"$nin": []string{"message_changed", "message_deleted", "channel_join", "channel_leave", "pinned_item"},
+		},
+		"hidden": bson.M{"$ne": true},
+	}
+
+	for k, v := range scope {
+		qry[k] = v
+	}
+
+	sort := "-ts"
+	if after {
+		qry["ts"] = bson.M{"$gt": ts}
+		sort = "ts"
+	} else {
+		qry["ts"] = bson.M{"$lt": ts}
+	}
+
+	messages := []models.Message{}
+	if limit == 0 {
+	} else if err := db.Messages.Find(qry).Sort(sort, "_id").Limit(limit).All(&messages); err != nil {
+		return nil, err
+	}
+
+	response := make([]MessageResponse, len(messages))
+	for i, message := range messages {
+		if err := api.decrypt(&message); err != nil {
+			return nil, err
+		}
+
+		// earlier messages have been retrieved newest first
+		j := i
+		if !after {
+			j = len(messages) - 1 - i
+		}
+
+		response[j] = *newMessageResponse(&message)
+	}
+
+	return response, nil
+}
+
+// contextHandler returns a message together with the messages surrounding
+// it in its channel, or in its thread if the message is a reply.
+func (api *api) contextHandler(ctx *Context) error {
+	response := struct {
+		Before  []MessageResponse `json:"before"`
+		Message MessageResponse   `json:"message"`
+		After   []MessageResponse `json:"after"`
+		Related struct {
+			Users map[string]UserResponse `json:"users"`
+		} `json:"related"`
+	}{}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	message, err := api.message(ctx.db, team.ID, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	before, after := 10, 10
+	if val, err := strconv.Atoi(ctx.r.FormValue("before")); err == nil && val >= 0 && val <= 100 {
+		before = val
+	}
+
+	if val, err := strconv.Atoi(ctx.r.FormValue("after")); err == nil && val >= 0 && val <= 100 {
+		after = val
+	}
+
+	scope := bson.M{
+		"team":    message.Team,
+		"channel": message.Channel,
+	}
+
+	if message.ThreadTimestamp != "" && message.ThreadTimestamp != message.Timestamp {
+		// a reply, the thread consists of the parent and its replies
+		scope["$or"] = []bson.M{
+			bson.M{"ts": message.ThreadTimestamp},
+			bson.M{"thread_ts": message.ThreadTimestamp},
+		}
+	} else {
+		// a channel message, replies are left out unless broadcast to the channel
+		scope["$or"] = []bson.M{
+			bson.M{"thread_ts": bson.M{"$exists": false}},
+			bson.M{"subtype": "thread_broadcast"},
+			bson.M{"$where": "this.thread_ts == this.ts"},
+		}
+	}
+
+	if response.Before, err = api.contextMessages(ctx.db, scope, message.Timestamp, false, before); err != nil {
+		return err
+	}
+
+	response.Message = *newMessageResponse(message)
+
+	if response.After, err = api.contextMessages(ctx.db, scope, message.Timestamp, true, after); err != nil {
+		return err
+	}
+
+	messages := append([]MessageResponse{response.Message}, response.Before...)
+	messages = append(messages, response.After...)
+
+	users, err := relatedUsers(ctx.db, messages)
+	if err != nil {
+		return err
+	}
+
+	response.Related.Users = users
+
+	return ctx.Write(response)
+}
+
+// messagesQuery returns the query for the search parameters of ctx, and the
+// filter on the channels of team that are still being archived. With fuzzy,
+// free text is matched fuzzily.
+func (api *api) messagesQuery(ctx *Context, team *models.Team, fuzzy bool) (*searchQuery, *elastic.BoolQuery, *elastic.BoolQuery, error) {
+	qs := elastic.NewBoolQuery()
+
+	qs = qs.Must(elastic.NewMatchAllQuery())
+
+	sq := &searchQuery{}
+	if val := ctx.r.FormValue("q"); val != "" {
+		var err error
+		if sq, err = parseQuery(val); err != nil {
+			return nil, nil, nil, err
+		}
+
+		sq.Fuzzy = fuzzy
+		sq.Code = ctx.r.FormValue("mode") == "code"
+
+		q, err := sq.compile(ctx.db, team.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		qs = qs.Must(q)
+	}
+
+	var pf = elastic.NewBoolQuery()
+
+	var fq = messagesFilter(team.ID)
+
+	channels, err := visibleChannels(ctx.db, team.ID, ctx.r.FormValue("channel"))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	pf = pf.Must(elastic.NewTermsQuery("channel.raw", channels...))
+
+	if val := ctx.r.FormValue("qfrom"); val == "" {
+	} else if qfrom, err := strconv.ParseFloat(ctx.r.FormValue("qfrom"), 64); err != nil {
+	} else if val := ctx.r.FormValue("qto"); val == "" {
+	} else if qto, err := strconv.ParseFloat(ctx.r.FormValue("qto"), 64); err != nil {
+	} else {
+		log.Info("Using qfrom and qto")
+		qs = qs.Must(elastic.NewRangeQuery("ts.float").Gte(qfrom).Lt(qto))
+	}
+
+	// TODO: check if channel is public
+	/*
+		if count, err := ctx.db.Teams.Find(bson.M{
+			"is_disabled": bson.M{
+				"$not": bson.M{"$eq": true},
+			},
+			"_id": team_id,
+		}).Count(); err != nil {
+			fmt.Printf("Error: %#v\n", err.Error())
+			return err
+		} else if count == 0 {
+			return fmt.Errorf("Team is disabled or does not exist")
+		}
+	*/
+
+	if val := ctx.r.FormValue("thread"); val == "" {
+	} else if val, err := strconv.ParseFloat(val, 64); err != nil {
+	} else {
+		fq = fq.Must(elastic.NewTermQuery("thread_ts.float", val))
+	}
+
+	from := float64(0)
+	if val, err := strconv.ParseFloat(ctx.r.FormValue("from"), 64); err == nil {
+		from = val
+	}
+
+	to := float64(time.Now().Unix())
+	if val, err := strconv.ParseFloat(ctx.r.FormValue("to"), 64); err == nil {
+		to = val
+	}
+
+	fq = fq.Must(elastic.NewRangeQuery("ts.float").Gte(from).Lt(to))
+
+	qs = qs.Filter(fq)
+
+	return sq, qs, pf, nil
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha1"
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 
 	"github.com/dutchcoders/slackarchive/utils"
@@ -62,10 +63,66 @@ func (cookie *OAuthCookie) Delete() {
 	cookie.s.Save(cookie.ctx.r, cookie.ctx.w)
 }
 
+func GetSessionCookie(ctx *Context, name string) (*SessionCookie, error) {
+	cookie := SessionCookie{ctx: ctx, name: name}
+	return &cookie, cookie.Get()
+}
+
+// SessionCookie contains the slack user and team a user signed in with.
+type SessionCookie struct {
+	Cookie
+	ctx  *Context
+	name string
+	s    *sessions.Session
+}
+
+func (cookie *SessionCookie) Get() error {
+	var err error
+	cookie.s, err = cookie.ctx.store.Get(cookie.ctx.r, cookie.name)
+
+	cookie.s.Options = &sessions.Options{
+		Path:     "/",
+		HttpOnly: true,
+		MaxAge:   30 * 24 * 60 * 60,
+	}
+
+	return err
+}
+
+func (cookie *SessionCookie) User() string {
+	if user, ok := cookie.s.Values["user"]; ok {
+		return user.(string)
+	}
+
+	return ""
+}
+
+func (cookie *SessionCookie) Team() string {
+	if team, ok := cookie.s.Values["team"]; ok {
+		return team.(string)
+	}
+
+	return ""
+}
+
+func (cookie *SessionCookie) SetUser(team, user string) {
+	cookie.s.Values["team"] = team
+	cookie.s.Values["user"] = user
+}
+
+func (cookie *SessionCookie) Save() {
+	cookie.s.Save(cookie.ctx.r, cookie.ctx.w)
+}
+
+func (cookie *SessionCookie) Delete() {
+	cookie.s.Options.MaxAge = -1
+	cookie.s.Save(cookie.ctx.r, cookie.ctx.w)
+}
+
 func (api *api) validateOAuthResponse(ctx *Context) error {
 	slackError := ctx.r.FormValue("error")
 	if slackError != "" {
-		return fmt.Errorf(slackError)
+		return errors.New(slackError)
 	}
 
 	code := ctx.r.FormValue("code")
@@ -113,8 +170,42 @@ func (api *api) oAuthCallbackHandler(ctx *Context) error {
 
 	log.Info("%#v", response)
 
+	cookie, _ := GetSessionCookie(ctx, api.sessionName())
+	cookie.SetUser(response.TeamID, response.UserID)
+	cookie.Save()
+
 	return ctx.Write(struct {
-	}{})
+		User string `json:"user_id"`
+		Team string `json:"team_id"`
+	}{
+		User: response.UserID,
+		Team: response.TeamID,
+	})
+}
+
+func (api *api) sessionName() string {
+	if api.config.SessionName == "" {
+		return "session"
+	}
+
+	return api.config.SessionName
+}
+
+// UserHandlerFunc only allows requests of users that signed in with slack.
+func (api *api) UserHandlerFunc(h ContextFunc) http.HandlerFunc {
+	return api.ContextHandlerFunc(func(ctx *Context) error {
+		cookie, err := GetSessionCookie(ctx, api.sessionName())
+		if err != nil {
+			return ErrNotAuthorized
+		} else if cookie.User() == "" || cookie.Team() == "" {
+			return ErrNotAuthorized
+		}
+
+		ctx.user = cookie.User()
+		ctx.team = cookie.Team()
+
+		return h(ctx)
+	})
 }
 
 func (api *api) oAuthLoginHandler(ctx *Context) error {
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gopkg.in/mgo.v2/bson"
+
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+// Thread describes the thread a message is part of, by the timestamp of
+// its parent.
+type Thread struct {
+	Timestamp   string   `json:"ts"`
+	ReplyCount  int      `json:"reply_count"`
+	ReplyUsers  []string `json:"reply_users"`
+	LatestReply string   `json:"latest_reply,omitempty"`
+}
+
+// Permalink contains the links to open a message in the Slack app and in
+// the browser.
+type Permalink struct {
+	App string `json:"app"`
+	Web string `json:"web,omitempty"`
+}
+
+// messageID returns the id of the message posted at ts in channel.
+func messageID(team, channel, ts string) string {
+	return fmt.Sprintf("%s-%s-%s", team, channel, ts)
+}
+
+// permalink returns the links to message in Slack. The web link is only
+// available if the domain of the team is known.
+func permalink(team *models.Team, message *models.Message) Permalink {
+	app := url.Values{}
+	app.Set("team", team.ID)
+	app.Set("id", message.Channel)
+	app.Set("message", message.Timestamp)
+
+	link := Permalink{
+		App: "slack://channel?" + app.Encode(),
+	}
+
+	if team.Domain == "" {
+		return link
+	}
+
+	link.Web = fmt.Sprintf("https://%s.slack.com/archives/%s/p%s", team.Domain, message.Channel, strings.Replace(message.Timestamp, ".", "", 1))
+
+	if message.ThreadTimestamp != "" && message.ThreadTimestamp != message.Timestamp {
+		web := url.Values{}
+		web.Set("thread_ts", message.ThreadTimestamp)
+		web.Set("cid", message.Channel)
+
+		link.Web += "?" + web.Encode()
+	}
+
+	return link
+}
+
+// thread returns the thread of message, or nil if message isn't part of a
+// thread.
+func thread(db *database, message *models.Message) (*Thread, error) {
+	if message.ThreadTimestamp == "" {
+		return nil, nil
+	}
+
+	qry := bson.M{
+		"team":      message.Team,
+		"channel":   message.Channel,
+		"thread_ts": message.ThreadTimestamp,
+		"ts":        bson.M{"$ne": message.ThreadTimestamp},
+		"hidden":    bson.M{"$ne": true},
+	}
+
+	t := Thread{
+		Timestamp:  message.ThreadTimestamp,
+		ReplyUsers: []string{},
+	}
+
+	var err error
+	if t.ReplyCount, err = db.Messages.Find(qry).Count(); err != nil {
+		return nil, err
+	}
+
+	if err := db.Messages.Find(qry).Distinct("user", &t.ReplyUsers); err != nil {
+		return nil, err
+	}
+
+	latest := models.Message{}
+	if t.ReplyCount == 0 {
+	} else if err := db.Messages.Find(qry).Select(bson.M{"ts": 1}).Sort("-ts").One(&latest); err != nil {
+		return nil, err
+	} else {
+		t.LatestReply = latest.Timestamp
+	}
+
+	return &t, nil
+}
+
+// permalinkHandler returns a single message by its id, or by its channel
+// and timestamp, with its thread and the links to open it in Slack.
+func (api *api) permalinkHandler(ctx *Context) error {
+	response := struct {
+		Message   MessageResponse `json:"message"`
+		Thread    *Thread         `json:"thread,omitempty"`
+		Permalink Permalink       `json:"permalink"`
+		Related   struct {
+			Users map[string]UserResponse `json:"users"`
+		} `json:"related"`
+	}{}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	id := ctx.Vars["id"]
+	if id != "" {
+	} else if channels, err := resolveChannels(ctx.db, team.ID, []string{ctx.Vars["channel"]}); err != nil {
+		// the channel can be referred to by name as well
+		return ErrMessageNotFound
+	} else {
+		id = messageID(team.ID, channels[0].(string), ctx.Vars["ts"])
+	}
+
+	message, err := api.message(ctx.db, team.ID, id)
+	if err != nil {
+		return err
+	}
+
+	response.Message = *newMessageResponse(message)
+	response.Permalink = permalink(team, message)
+
+	if response.Thread, err = thread(ctx.db, message); err != nil {
+		return err
+	}
+
+	users, err := relatedUsers(ctx.db, []MessageResponse{response.Message})
+	if err != nil {
+		return err
+	}
+
+	response.Related.Users = users
+
+	return ctx.Write(response)
+}
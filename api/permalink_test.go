@@ -0,0 +1,64 @@
+package api
+
+import (
+	"testing"
+
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+func TestMessageID(t *testing.T) {
+	if id := messageID("T1", "C1", "1500000000.000100"); id != "T1-C1-1500000000.000100" {
+		t.Errorf("expected T1-C1-1500000000.000100, got %s", id)
+	}
+}
+
+func TestPermalink(t *testing.T) {
+	tests := []struct {
+		name     string
+		team     models.Team
+		message  models.Message
+		expected Permalink
+	}{
+		{
+			name:    "without domain",
+			team:    models.Team{ID: "T1"},
+			message: models.Message{Channel: "C1", Timestamp: "1500000000.000100"},
+			expected: Permalink{
+				App: "slack://channel?id=C1&message=1500000000.000100&team=T1",
+			},
+		},
+		{
+			name:    "message",
+			team:    models.Team{ID: "T1", Domain: "acme"},
+			message: models.Message{Channel: "C1", Timestamp: "1500000000.000100"},
+			expected: Permalink{
+				App: "slack://channel?id=C1&message=1500000000.000100&team=T1",
+				Web: "https://acme.slack.com/archives/C1/p1500000000000100",
+			},
+		},
+		{
+			name:    "thread parent",
+			team:    models.Team{ID: "T1", Domain: "acme"},
+			message: models.Message{Channel: "C1", Timestamp: "1500000000.000100", ThreadTimestamp: "1500000000.000100"},
+			expected: Permalink{
+				App: "slack://channel?id=C1&message=1500000000.000100&team=T1",
+				Web: "https://acme.slack.com/archives/C1/p1500000000000100",
+			},
+		},
+		{
+			name:    "thread reply",
+			team:    models.Team{ID: "T1", Domain: "acme"},
+			message: models.Message{Channel: "C1", Timestamp: "1500000060.000200", ThreadTimestamp: "1500000000.000100"},
+			expected: Permalink{
+				App: "slack://channel?id=C1&message=1500000060.000200&team=T1",
+				Web: "https://acme.slack.com/archives/C1/p1500000060000200?cid=C1&thread_ts=1500000000.000100",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		if actual := permalink(&test.team, &test.message); actual != test.expected {
+			t.Errorf("%s: expected %+v, got %+v", test.name, test.expected, actual)
+		}
+	}
+}
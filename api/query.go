@@ -0,0 +1,429 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// searchQuery is a search query using the Slack search modifiers, e.g.
+// `deploy from:@alice in:#ops has:link before:2017-01-01`.
+type searchQuery struct {
+	Text []string
+
+	From []string
+	In   []string
+	To   []string
+	Has  []string
+
+	After  *time.Time
+	Before *time.Time
+
+	IsThread bool
+
+	// Code matches the free text against code blocks and inline code only
+	Code bool
+
+	// Modifiers are the modifier tokens of the query as entered
+	Modifiers []string
+
+	// Fuzzy matches free text terms within a small edit distance
+	Fuzzy bool
+}
+
+func errInvalidQuery(format string, args ...interface{}) error {
+	return errors.New("invalid-query", fmt.Sprintf(format, args...), http.StatusBadRequest)
+}
+
+// tokenize splits q on whitespace, keeping quoted phrases together.
+func tokenize(q string) ([]string, error) {
+	tokens := []string{}
+
+	token := ""
+	quoted := false
+
+	for _, r := range q {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			token += string(r)
+		case !quoted && (r == ' ' || r == '\t' || r == '\n'):
+			if token != "" {
+				tokens = append(tokens, token)
+			}
+
+			token = ""
+		default:
+			token += string(r)
+		}
+	}
+
+	if quoted {
+		return nil, errInvalidQuery("Unterminated quote in query")
+	}
+
+	if token != "" {
+		tokens = append(tokens, token)
+	}
+
+	return tokens, nil
+}
+
+var (
+	userRe    = regexp.MustCompile(`^<@([A-Z0-9]+)(\|[^>]*)?>$`)
+	channelRe = regexp.MustCompile(`^<#([A-Z0-9]+)(\|[^>]*)?>$`)
+)
+
+// parseQuery parses the Slack search modifiers in q, all other terms are
+// kept as free text.
+func parseQuery(q string) (*searchQuery, error) {
+	tokens, err := tokenize(q)
+	if err != nil {
+		return nil, err
+	}
+
+	sq := searchQuery{}
+
+	for _, token := range tokens {
+		parts := strings.SplitN(token, ":", 2)
+		if len(parts) != 2 {
+			sq.Text = append(sq.Text, token)
+			continue
+		}
+
+		key, value := strings.ToLower(parts[0]), strings.Trim(parts[1], `"`)
+
+		switch key {
+		case "from", "in", "to", "has", "is", "before", "after", "on", "during":
+		default:
+			// not a modifier, could be a lucene field query
+			sq.Text = append(sq.Text, token)
+			continue
+		}
+
+		if value == "" {
+			return nil, errInvalidQuery("Modifier %s: requires a value", key)
+		}
+
+		sq.Modifiers = append(sq.Modifiers, token)
+
+		switch key {
+		case "from":
+			sq.From = append(sq.From, parseUser(value))
+		case "to":
+			sq.To = append(sq.To, parseUser(value))
+		case "in":
+			if matches := channelRe.FindStringSubmatch(value); matches != nil {
+				value = matches[1]
+			}
+
+			sq.In = append(sq.In, strings.TrimPrefix(value, "#"))
+		case "has":
+			switch value = strings.ToLower(value); value {
+			case "link", "file", "pin", "reaction", "code":
+				sq.Has = append(sq.Has, value)
+			default:
+				return nil, errInvalidQuery("Unknown modifier has:%s, expected link, file, pin, reaction or code", value)
+			}
+		case "is":
+			switch strings.ToLower(value) {
+			case "thread":
+				sq.IsThread = true
+			default:
+				return nil, errInvalidQuery("Unknown modifier is:%s, expected thread", value)
+			}
+		default:
+			start, end, err := parseDate(value, key == "during")
+			if err != nil {
+				return nil, err
+			}
+
+			switch key {
+			case "before":
+				if sq.Before != nil {
+					return nil, errInvalidQuery("Modifier %s: conflicts with an earlier date modifier", key)
+				}
+
+				sq.Before = &start
+			case "after":
+				if sq.After != nil {
+					return nil, errInvalidQuery("Modifier %s: conflicts with an earlier date modifier", key)
+				}
+
+				sq.After = &end
+			case "on", "during":
+				if sq.After != nil || sq.Before != nil {
+					return nil, errInvalidQuery("Modifier %s: conflicts with an earlier date modifier", key)
+				}
+
+				sq.After = &start
+				sq.Before = &end
+			}
+		}
+	}
+
+	if sq.After != nil && sq.Before != nil && !sq.After.Before(*sq.Before) {
+		return nil, errInvalidQuery("Date range is empty")
+	}
+
+	return &sq, nil
+}
+
+func parseUser(value string) string {
+	if matches := userRe.FindStringSubmatch(value); matches != nil {
+		return matches[1]
+	}
+
+	return strings.TrimPrefix(value, "@")
+}
+
+// parseDate returns the start and end (exclusive) of the day in value.
+// With period, months and years are accepted as well.
+func parseDate(value string, period bool) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	switch strings.ToLower(value) {
+	case "today":
+		return today, today.AddDate(0, 0, 1), nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), today, nil
+	}
+
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, t.AddDate(0, 0, 1), nil
+	}
+
+	if !period {
+		return time.Time{}, time.Time{}, errInvalidQuery("Invalid date %s, expected YYYY-MM-DD", value)
+	}
+
+	if t, err := time.Parse("2006-01", value); err == nil {
+		return t, t.AddDate(0, 1, 0), nil
+	} else if t, err := time.Parse("2006", value); err == nil {
+		return t, t.AddDate(1, 0, 0), nil
+	}
+
+	return time.Time{}, time.Time{}, errInvalidQuery("Invalid period %s, expected YYYY, YYYY-MM or YYYY-MM-DD", value)
+}
+
+// resolveUsers returns the ids of the users of team with the names or ids
+// in names.
+func resolveUsers(db *database, team string, names []string) ([]interface{}, error) {
+	ids := []interface{}{}
+	for _, name := range names {
+		user := models.User{}
+		if err := db.Users.Find(bson.M{
+			"team": team,
+			"$or": []bson.M{
+				bson.M{"_id": name},
+				bson.M{"name": name},
+			},
+		}).One(&user); err != nil {
+			return nil, errInvalidQuery("Unknown user @%s", name)
+		}
+
+		ids = append(ids, user.ID)
+	}
+
+	return ids, nil
+}
+
+// resolveChannels returns the ids of the channels of team with the names or
+// ids in names.
+func resolveChannels(db *database, team string, names []string) ([]interface{}, error) {
+	ids := []interface{}{}
+	for _, name := range names {
+		channel := models.Channel{}
+		if err := db.Channels.Find(bson.M{
+			"team": team,
+			"$or": []bson.M{
+				bson.M{"_id": name},
+				bson.M{"name": name},
+			},
+		}).One(&channel); err != nil {
+			return nil, errInvalidQuery("Unknown channel #%s", name)
+		}
+
+		ids = append(ids, channel.ID)
+	}
+
+	return ids, nil
+}
+
+// hasLinkQuery matches messages containing a link.
+func hasLinkQuery() elastic.Query {
+	return elastic.NewBoolQuery().
+		MinimumShouldMatch("1").
+		Should(
+			elastic.NewMatchQuery("text", "http https"),
+			elastic.NewExistsQuery("attachments.title_link"),
+			elastic.NewNestedQuery("links", elastic.NewExistsQuery("links.url")).IgnoreUnmapped(true),
+		)
+}
+
+// textQuery matches text against all fields, against the text analyzed for
+// one of the languages of the team or against the code in messages. The
+// vocabulary of the team is applied to the query.
+func textQuery(text string, settings *models.TeamSettings) elastic.Query {
+	q := elastic.NewQueryStringQuery(text).DefaultOperator("AND")
+	if settings.HasVocabulary() {
+		q = q.Analyzer(searchAnalyzer(settings.Team, ""))
+	}
+
+	bq := elastic.NewBoolQuery().
+		MinimumShouldMatch("1").
+		Should(
+			q,
+			elastic.NewMatchQuery(codeField, strings.Replace(text, `"`, "", -1)).Operator("and"),
+		)
+
+	for _, lang := range searchLanguages(settings) {
+		lq := elastic.NewQueryStringQuery(text).
+			DefaultOperator("AND").
+			Field(languageField(lang))
+
+		if settings.HasVocabulary() {
+			lq = lq.Analyzer(searchAnalyzer(settings.Team, lang))
+		}
+
+		bq = bq.Should(lq)
+	}
+
+	return bq
+}
+
+// fuzzyQuery matches the terms of text within an edit distance depending on
+// the length of the term. Phrases and query syntax are matched as plain
+// terms.
+func fuzzyQuery(text string) elastic.Query {
+	return elastic.NewMultiMatchQuery(strings.Replace(text, `"`, "", -1), "text", "text_*", "attachments.text", "file.title").
+		Fuzziness("AUTO").
+		PrefixLength(1).
+		Operator("and")
+}
+
+// compile returns the elasticsearch query for sq, resolving user and
+// channel names of team.
+func (sq *searchQuery) compile(db *database, team string) (elastic.Query, error) {
+	q := elastic.NewBoolQuery()
+
+	if len(sq.Text) > 0 {
+		text := strings.Join(sq.Text, " ")
+
+		if sq.Code {
+			q = q.Must(codeQuery(sq.Text))
+		} else if sq.Fuzzy {
+			q = q.Must(fuzzyQuery(text))
+		} else if settings, err := teamSettings(db, team); err != nil {
+			return nil, err
+		} else {
+			q = q.Must(textQuery(text, settings))
+		}
+	}
+
+	if len(sq.From) > 0 {
+		ids, err := resolveUsers(db, team, sq.From)
+		if err != nil {
+			return nil, err
+		}
+
+		q = q.Filter(elastic.NewTermsQuery("user.raw", ids...))
+	}
+
+	if len(sq.To) > 0 {
+		ids, err := resolveUsers(db, team, sq.To)
+		if err != nil {
+			return nil, err
+		}
+
+		mentions, err := mentionsQuery(db, team, ids)
+		if err != nil {
+			return nil, err
+		}
+
+		q = q.Filter(mentions)
+	}
+
+	if len(sq.In) > 0 {
+		ids, err := resolveChannels(db, team, sq.In)
+		if err != nil {
+			return nil, err
+		}
+
+		q = q.Filter(elastic.NewTermsQuery("channel.raw", ids...))
+	}
+
+	for _, has := range sq.Has {
+		switch has {
+		case "link":
+			q = q.Filter(hasLinkQuery())
+		case "file":
+			q = q.Filter(elastic.NewExistsQuery("file.id"))
+		case "pin":
+			q = q.Filter(elastic.NewExistsQuery("pinned_to"))
+		case "reaction":
+			q = q.Filter(elastic.NewExistsQuery("reactions.name"))
+		case "code":
+			q = q.Filter(elastic.NewExistsQuery(codeField))
+		}
+	}
+
+	if sq.IsThread {
+		q = q.Filter(elastic.NewExistsQuery("thread_ts"))
+	}
+
+	if sq.After != nil || sq.Before != nil {
+		rq := elastic.NewRangeQuery("ts.float")
+		if sq.After != nil {
+			rq = rq.Gte(sq.After.Unix())
+		}
+
+		if sq.Before != nil {
+			rq = rq.Lt(sq.Before.Unix())
+		}
+
+		q = q.Filter(rq)
+	}
+
+	return q, nil
+}
+
+// relevance returns q scored for sorting by relevance. Exact phrases score
+// above separate terms, the message text above attachments and recent
+// messages above older ones.
+func (sq *searchQuery) relevance(q elastic.Query) elastic.Query {
+	bq := elastic.NewBoolQuery().Must(q)
+
+	if text := strings.Replace(strings.Join(sq.Text, " "), `"`, "", -1); text != "" {
+		bq = bq.Should(
+			elastic.NewMatchPhraseQuery("text", text).Boost(4),
+			elastic.NewMatchPhraseQuery("attachments.text", text).Boost(2),
+			elastic.NewMatchQuery("text", text).Boost(2),
+			elastic.NewMatchQuery("attachments.text", text),
+		)
+	}
+
+	// ts.float is in seconds, a five week old message scores half of a message
+	// from the last week
+	decay := elastic.NewGaussDecayFunction().
+		FieldName("ts.float").
+		Origin(time.Now().Unix()).
+		Offset(7 * 24 * 60 * 60).
+		Scale(30 * 24 * 60 * 60).
+		Decay(0.5)
+
+	return elastic.NewFunctionScoreQuery().
+		Query(bq).
+		AddScoreFunc(decay).
+		BoostMode("multiply")
+}
@@ -0,0 +1,195 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(value string) *time.Time {
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		panic(err)
+	}
+
+	return &t
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		q        string
+		expected []string
+		err      bool
+	}{
+		{"", []string{}, false},
+		{"deploy prod", []string{"deploy", "prod"}, false},
+		{"  deploy\t\tprod\n", []string{"deploy", "prod"}, false},
+		{`"prod down" again`, []string{`"prod down"`, "again"}, false},
+		{`in:"my channel" x`, []string{`in:"my channel"`, "x"}, false},
+		{`"prod down`, nil, true},
+	}
+
+	for _, test := range tests {
+		tokens, err := tokenize(test.q)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.q)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("%q: unexpected error %s", test.q, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(tokens, test.expected) {
+			t.Errorf("%q: expected %q, got %q", test.q, test.expected, tokens)
+		}
+	}
+}
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		q        string
+		expected searchQuery
+		err      bool
+	}{
+		{
+			q: "deploy from:@alice in:#ops has:link",
+			expected: searchQuery{
+				Text:      []string{"deploy"},
+				From:      []string{"alice"},
+				In:        []string{"ops"},
+				Has:       []string{"link"},
+				Modifiers: []string{"from:@alice", "in:#ops", "has:link"},
+			},
+		},
+		{
+			q: "from:<@U0123|alice> to:@bob in:<#C0123|general>",
+			expected: searchQuery{
+				From:      []string{"U0123"},
+				To:        []string{"bob"},
+				In:        []string{"C0123"},
+				Modifiers: []string{"from:<@U0123|alice>", "to:@bob", "in:<#C0123|general>"},
+			},
+		},
+		{
+			q: "status:open FROM:alice",
+			expected: searchQuery{
+				Text:      []string{"status:open"},
+				From:      []string{"alice"},
+				Modifiers: []string{"FROM:alice"},
+			},
+		},
+		{
+			q: "has:CODE is:thread",
+			expected: searchQuery{
+				Has:       []string{"code"},
+				IsThread:  true,
+				Modifiers: []string{"has:CODE", "is:thread"},
+			},
+		},
+		{
+			q: "after:2016-12-01 before:2017-01-01",
+			expected: searchQuery{
+				After:     date("2016-12-02"),
+				Before:    date("2017-01-01"),
+				Modifiers: []string{"after:2016-12-01", "before:2017-01-01"},
+			},
+		},
+		{
+			q: "on:2017-01-01",
+			expected: searchQuery{
+				After:     date("2017-01-01"),
+				Before:    date("2017-01-02"),
+				Modifiers: []string{"on:2017-01-01"},
+			},
+		},
+		{
+			q: "during:2017-02",
+			expected: searchQuery{
+				After:     date("2017-02-01"),
+				Before:    date("2017-03-01"),
+				Modifiers: []string{"during:2017-02"},
+			},
+		},
+		{
+			q: "during:2017",
+			expected: searchQuery{
+				After:     date("2017-01-01"),
+				Before:    date("2018-01-01"),
+				Modifiers: []string{"during:2017"},
+			},
+		},
+		{q: "from:", err: true},
+		{q: "has:image", err: true},
+		{q: "is:open", err: true},
+		{q: "on:2017-02", err: true},
+		{q: "before:01-01-2017", err: true},
+		{q: "after:2017-01-02 before:2017-01-02", err: true},
+		{q: "before:2017-01-01 before:2017-02-01", err: true},
+		{q: "after:2017-01-01 after:2017-02-01", err: true},
+		{q: "on:2017-01-01 after:2016-01-01", err: true},
+		{q: "after:2016-01-01 on:2017-01-01", err: true},
+		{q: "before:2017-01-01 during:2016", err: true},
+		{q: `"prod down`, err: true},
+	}
+
+	for _, test := range tests {
+		sq, err := parseQuery(test.q)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.q)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("%q: unexpected error %s", test.q, err.Error())
+			continue
+		}
+
+		if !reflect.DeepEqual(*sq, test.expected) {
+			t.Errorf("%q: expected %+v, got %+v", test.q, test.expected, *sq)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value  string
+		period bool
+		start  time.Time
+		end    time.Time
+		err    bool
+	}{
+		{value: "today", start: today, end: today.AddDate(0, 0, 1)},
+		{value: "Yesterday", start: today.AddDate(0, 0, -1), end: today},
+		{value: "2017-02-28", start: *date("2017-02-28"), end: *date("2017-03-01")},
+		{value: "2016-12", period: true, start: *date("2016-12-01"), end: *date("2017-01-01")},
+		{value: "2016", period: true, start: *date("2016-01-01"), end: *date("2017-01-01")},
+		{value: "2016-12", err: true},
+		{value: "2017-02-30", err: true},
+		{value: "last week", period: true, err: true},
+	}
+
+	for _, test := range tests {
+		start, end, err := parseDate(test.value, test.period)
+		if test.err {
+			if err == nil {
+				t.Errorf("%q: expected error", test.value)
+			}
+
+			continue
+		} else if err != nil {
+			t.Errorf("%q: unexpected error %s", test.value, err.Error())
+			continue
+		}
+
+		if !start.Equal(test.start) || !end.Equal(test.end) {
+			t.Errorf("%q: expected %s - %s, got %s - %s", test.value, test.start, test.end, start, end)
+		}
+	}
+}
@@ -0,0 +1,427 @@
+package api
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+// systemSubtypes are the subtypes of messages that aren't requests or
+// replies, messages of bots are left out as well.
+var systemSubtypes = []string{
+	"channel_join", "channel_leave", "channel_topic", "channel_purpose", "channel_name", "channel_archive", "channel_unarchive",
+	"group_join", "group_leave", "group_topic", "group_purpose", "group_name", "group_archive", "group_unarchive",
+	"message_changed", "message_deleted", "message_replied", "pinned_item", "unpinned_item",
+	"bot_message", "bot_add", "bot_remove",
+}
+
+// Durations summarizes response times in seconds.
+type Durations struct {
+	Count  int     `json:"count"`
+	Median float64 `json:"median"`
+	P90    float64 `json:"p90"`
+	Mean   float64 `json:"mean"`
+}
+
+func durations(values []float64) Durations {
+	d := Durations{
+		Count: len(values),
+	}
+
+	if len(values) == 0 {
+		return d
+	}
+
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+
+	sum := float64(0)
+	for _, value := range sorted {
+		sum += value
+	}
+
+	d.Median = percentile(sorted, 50)
+	d.P90 = percentile(sorted, 90)
+	d.Mean = sum / float64(len(sorted))
+	return d
+}
+
+// percentile returns the nearest rank percentile p of sorted.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+
+	return sorted[rank]
+}
+
+// ThreadMetrics contains the response times of a single request, a top
+// level message of a person, in seconds. Replies of the author of the
+// request are not counted as responses.
+type ThreadMetrics struct {
+	Channel        string   `json:"channel"`
+	Timestamp      string   `json:"ts"`
+	User           string   `json:"user"`
+	Replies        int      `json:"replies"`
+	FirstReply     *float64 `json:"first_reply,omitempty"`
+	LastReply      *float64 `json:"last_reply,omitempty"`
+	FirstResponder string   `json:"first_responder,omitempty"`
+
+	// responses contains the delay of the first reply per responder
+	responses map[string]float64
+}
+
+// ResponderMetrics contains the number of requests a user responded to,
+// their number of replies and the median time of their first reply.
+type ResponderMetrics struct {
+	User           string  `json:"user"`
+	Threads        int     `json:"threads"`
+	Replies        int     `json:"replies"`
+	MedianResponse float64 `json:"median_response"`
+}
+
+// ChannelResponsiveness contains the response times to the requests in a
+// channel.
+type ChannelResponsiveness struct {
+	Channel    string             `json:"channel"`
+	Name       string             `json:"name"`
+	Threads    int                `json:"threads"`
+	Answered   int                `json:"answered"`
+	Unanswered int                `json:"unanswered"`
+	FirstReply Durations          `json:"first_reply"`
+	LastReply  Durations          `json:"last_reply"`
+	Responders []ResponderMetrics `json:"responders"`
+
+	threads []*ThreadMetrics
+}
+
+// threadCollector collects the requests and their replies from the
+// messages of a channel, sorted by timestamp. Requests are top level messages
+// posted between after and before by people, with threadsOnly only those
+// that started a thread.
+type threadCollector struct {
+	after, before string
+	threadsOnly   bool
+
+	threads map[string]*ThreadMetrics
+	ordered []*ThreadMetrics
+
+	// replies contains the number of replies per responder
+	replies map[string]int
+}
+
+func newThreadCollector(from, to time.Time, threadsOnly bool) *threadCollector {
+	return &threadCollector{
+		after:       strconv.FormatInt(from.Unix(), 10),
+		before:      strconv.FormatInt(to.Unix(), 10),
+		threadsOnly: threadsOnly,
+		threads:     map[string]*ThreadMetrics{},
+		ordered:     []*ThreadMetrics{},
+		replies:     map[string]int{},
+	}
+}
+
+func (c *threadCollector) add(message *models.Message) {
+	if message.BotID != "" || message.SubType == "bot_message" || message.User == "" {
+		return
+	}
+
+	ts, err := strconv.ParseFloat(message.Timestamp, 64)
+	if err != nil {
+		return
+	}
+
+	if message.ThreadTimestamp == "" || message.ThreadTimestamp == message.Timestamp {
+		if message.Timestamp < c.after || message.Timestamp >= c.before {
+			return
+		} else if c.threadsOnly && message.ThreadTimestamp == "" {
+			return
+		}
+
+		thread := &ThreadMetrics{
+			Channel:   message.Channel,
+			Timestamp: message.Timestamp,
+			User:      message.User,
+			responses: map[string]float64{},
+		}
+
+		c.threads[message.Timestamp] = thread
+		c.ordered = append(c.ordered, thread)
+		return
+	}
+
+	thread, ok := c.threads[message.ThreadTimestamp]
+	if !ok || message.User == thread.User {
+		return
+	}
+
+	parent, _ := strconv.ParseFloat(thread.Timestamp, 64)
+	delay := ts - parent
+
+	thread.Replies++
+	c.replies[message.User]++
+
+	if thread.FirstReply == nil {
+		thread.FirstReply = &delay
+		thread.FirstResponder = message.User
+	}
+
+	thread.LastReply = &delay
+
+	if _, ok := thread.responses[message.User]; !ok {
+		thread.responses[message.User] = delay
+	}
+}
+
+// metrics returns the response times to the collected requests.
+func (c *threadCollector) metrics(channel *models.Channel) *ChannelResponsiveness {
+	cr := ChannelResponsiveness{
+		Channel:    channel.ID,
+		Name:       channel.Name,
+		Responders: []ResponderMetrics{},
+		threads:    c.ordered,
+	}
+
+	first, last := []float64{}, []float64{}
+	responses := map[string][]float64{}
+
+	for _, thread := range cr.threads {
+		cr.Threads++
+
+		if thread.FirstReply == nil {
+			cr.Unanswered++
+			continue
+		}
+
+		cr.Answered++
+
+		first = append(first, *thread.FirstReply)
+		last = append(last, *thread.LastReply)
+
+		for user, delay := range thread.responses {
+			responses[user] = append(responses[user], delay)
+		}
+	}
+
+	cr.FirstReply = durations(first)
+	cr.LastReply = durations(last)
+
+	for user, delays := range responses {
+		cr.Responders = append(cr.Responders, ResponderMetrics{
+			User:           user,
+			Threads:        len(delays),
+			Replies:        c.replies[user],
+			MedianResponse: durations(delays).Median,
+		})
+	}
+
+	sort.Slice(cr.Responders, func(i, j int) bool {
+		a, b := cr.Responders[i], cr.Responders[j]
+		if a.Threads != b.Threads {
+			return a.Threads > b.Threads
+		} else if a.MedianResponse != b.MedianResponse {
+			return a.MedianResponse < b.MedianResponse
+		}
+
+		return a.User < b.User
+	})
+
+	return &cr
+}
+
+// responsiveness returns the response times to the requests posted in
+// channel between from and to.
+func responsiveness(db *database, channel *models.Channel, from, to time.Time, threadsOnly bool) (*ChannelResponsiveness, error) {
+	c := newThreadCollector(from, to, threadsOnly)
+
+	// replies have the timestamp of their request as thread timestamp, so
+	// replies posted after the period are included
+	iter := db.Messages.Find(bson.M{
+		"team":    channel.Team,
+		"channel": channel.ID,
+		"subtype": bson.M{"$nin": systemSubtypes},
+		"hidden":  bson.M{"$ne": true},
+		"$or": []bson.M{
+			bson.M{"ts": bson.M{"$gte": c.after, "$lt": c.before}},
+			bson.M{"thread_ts": bson.M{"$gte": c.after, "$lt": c.before}},
+		},
+	}).Select(bson.M{
+		"channel":   1,
+		"user":      1,
+		"bot_id":    1,
+		"subtype":   1,
+		"ts":        1,
+		"thread_ts": 1,
+	}).Sort("ts").Batch(1000).Iter()
+	defer iter.Close()
+
+	for {
+		// fields missing from a document keep their previous value otherwise
+		message := models.Message{}
+		if !iter.Next(&message) {
+			break
+		}
+
+		c.add(&message)
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return c.metrics(channel), nil
+}
+
+func formatSeconds(value float64) string {
+	return strconv.FormatFloat(value, 'f', 0, 64)
+}
+
+// writeResponsivenessCSV writes report, channels, responders or threads,
+// as csv.
+func writeResponsivenessCSV(w *csv.Writer, report string, channels []*ChannelResponsiveness) error {
+	switch report {
+	case "channels":
+		w.Write([]string{"channel", "name", "threads", "answered", "unanswered",
+			"first_reply_median", "first_reply_p90", "first_reply_mean",
+			"last_reply_median", "last_reply_p90", "last_reply_mean"})
+
+		for _, cr := range channels {
+			w.Write([]string{cr.Channel, cr.Name, strconv.Itoa(cr.Threads), strconv.Itoa(cr.Answered), strconv.Itoa(cr.Unanswered),
+				formatSeconds(cr.FirstReply.Median), formatSeconds(cr.FirstReply.P90), formatSeconds(cr.FirstReply.Mean),
+				formatSeconds(cr.LastReply.Median), formatSeconds(cr.LastReply.P90), formatSeconds(cr.LastReply.Mean)})
+		}
+	case "responders":
+		w.Write([]string{"channel", "user", "threads", "replies", "median_response"})
+
+		for _, cr := range channels {
+			for _, responder := range cr.Responders {
+				w.Write([]string{cr.Channel, responder.User, strconv.Itoa(responder.Threads), strconv.Itoa(responder.Replies), formatSeconds(responder.MedianResponse)})
+			}
+		}
+	case "threads":
+		w.Write([]string{"channel", "ts", "user", "replies", "first_reply", "last_reply", "first_responder"})
+
+		for _, cr := range channels {
+			for _, thread := range cr.threads {
+				first, last := "", ""
+				if thread.FirstReply != nil {
+					first, last = formatSeconds(*thread.FirstReply), formatSeconds(*thread.LastReply)
+				}
+
+				w.Write([]string{cr.Channel, thread.Timestamp, thread.User, strconv.Itoa(thread.Replies), first, last, thread.FirstResponder})
+			}
+		}
+	}
+
+	w.Flush()
+	return w.Error()
+}
+
+// responsivenessHandler returns the response times to requests, top level
+// messages of people, in the channels of the team between from and to,
+// defaulting to the last 30 days. With threads_only=1 only messages that
+// started a thread are requests. With format=csv the report channels (default),
+// responders or threads is returned as csv.
+func (api *api) responsivenessHandler(ctx *Context) error {
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	to := time.Now()
+	if val, err := strconv.ParseInt(ctx.r.FormValue("to"), 10, 64); err == nil {
+		to = time.Unix(val, 0)
+	}
+
+	from := to.AddDate(0, 0, -30)
+	if val, err := strconv.ParseInt(ctx.r.FormValue("from"), 10, 64); err == nil {
+		from = time.Unix(val, 0)
+	}
+
+	format := ctx.r.FormValue("format")
+	threadsOnly := ctx.r.FormValue("threads_only") == "1"
+
+	report := ctx.r.FormValue("report")
+	if report == "" {
+		report = "channels"
+	}
+
+	verr := &errors.ValidationError{}
+	if !from.Before(to) {
+		verr.Add("from", "invalid", "From should be before to")
+	}
+
+	switch format {
+	case "", "json", "csv":
+	default:
+		verr.Add("format", "invalid", "Format should be json or csv")
+	}
+
+	switch report {
+	case "channels", "responders", "threads":
+	default:
+		verr.Add("report", "invalid", "Report should be channels, responders or threads")
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	qry := bson.M{
+		"team":      team.ID,
+		"is_member": true,
+	}
+
+	if val := ctx.r.FormValue("channel"); val != "" {
+		qry["$or"] = []bson.M{
+			bson.M{"_id": val},
+			bson.M{"name": val},
+		}
+	}
+
+	channels := []models.Channel{}
+	if err := ctx.db.Channels.Find(qry).Sort("name").All(&channels); err != nil {
+		return err
+	} else if len(channels) == 0 && ctx.r.FormValue("channel") != "" {
+		return ErrChannelNotFound
+	}
+
+	results := []*ChannelResponsiveness{}
+	for i := range channels {
+		cr, err := responsiveness(ctx.db, &channels[i], from, to, threadsOnly)
+		if err != nil {
+			return err
+		}
+
+		results = append(results, cr)
+	}
+
+	if format != "csv" {
+		return ctx.Write(struct {
+			From     int64                    `json:"from"`
+			To       int64                    `json:"to"`
+			Channels []*ChannelResponsiveness `json:"channels"`
+		}{
+			From:     from.Unix(),
+			To:       to.Unix(),
+			Channels: results,
+		})
+	}
+
+	ctx.w.Header().Set("Content-Type", "text/csv")
+	ctx.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=responsiveness-%s.csv", report))
+	ctx.w.WriteHeader(http.StatusOK)
+	ctx.bodyWritten = true
+
+	return writeResponsivenessCSV(csv.NewWriter(ctx.w), report, results)
+}
@@ -0,0 +1,174 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"reflect"
+	"testing"
+	"time"
+
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+func TestDurations(t *testing.T) {
+	tests := []struct {
+		values   []float64
+		expected Durations
+	}{
+		{[]float64{}, Durations{}},
+		{[]float64{60}, Durations{Count: 1, Median: 60, P90: 60, Mean: 60}},
+		{[]float64{30, 10, 20, 40}, Durations{Count: 4, Median: 20, P90: 40, Mean: 25}},
+		{[]float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100}, Durations{Count: 10, Median: 50, P90: 90, Mean: 55}},
+	}
+
+	for _, test := range tests {
+		if actual := durations(test.values); actual != test.expected {
+			t.Errorf("%v: expected %+v, got %+v", test.values, test.expected, actual)
+		}
+	}
+
+	values := []float64{3, 1, 2}
+	durations(values)
+
+	if !reflect.DeepEqual(values, []float64{3, 1, 2}) {
+		t.Errorf("expected values to be left unsorted, got %v", values)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+
+	tests := []struct {
+		p        float64
+		expected float64
+	}{
+		{0, 1},
+		{20, 1},
+		{21, 2},
+		{50, 3},
+		{90, 5},
+		{100, 5},
+	}
+
+	for _, test := range tests {
+		if actual := percentile(sorted, test.p); actual != test.expected {
+			t.Errorf("p%v: expected %v, got %v", test.p, test.expected, actual)
+		}
+	}
+}
+
+func TestThreadCollector(t *testing.T) {
+	from, to := time.Unix(1000, 0), time.Unix(2000, 0)
+
+	messages := []models.Message{
+		// replies to a request before the period are left out
+		{User: "U1", Timestamp: "900.500000", ThreadTimestamp: "900.500000"},
+		{User: "U2", Timestamp: "1005.500000", ThreadTimestamp: "900.500000"},
+
+		// answered by U2 and U3, the follow up of the author isn't a reply
+		{User: "U1", Timestamp: "1000.500000", ThreadTimestamp: "1000.500000"},
+		{User: "U1", Timestamp: "1010.500000", ThreadTimestamp: "1000.500000"},
+		{User: "U2", Timestamp: "1060.500000", ThreadTimestamp: "1000.500000"},
+		{User: "U3", Timestamp: "1120.500000", ThreadTimestamp: "1000.500000"},
+		{User: "U2", Timestamp: "1300.500000", ThreadTimestamp: "1000.500000"},
+
+		// unanswered
+		{User: "U4", Timestamp: "1100.500000"},
+
+		// bots are neither requests nor responders
+		{User: "U5", BotID: "B1", Timestamp: "1150.500000", ThreadTimestamp: "1150.500000"},
+		{SubType: "bot_message", BotID: "B1", Timestamp: "1200.500000", ThreadTimestamp: "1100.500000"},
+		{User: "U6", BotID: "B2", Timestamp: "1210.500000", ThreadTimestamp: "1000.500000"},
+
+		// answered by U3, the reply is posted after the period
+		{User: "U4", Timestamp: "1900.500000", ThreadTimestamp: "1900.500000"},
+		{User: "U3", Timestamp: "2500.500000", ThreadTimestamp: "1900.500000"},
+
+		// after the period
+		{User: "U1", Timestamp: "2000.500000"},
+	}
+
+	c := newThreadCollector(from, to, false)
+	for i := range messages {
+		c.add(&messages[i])
+	}
+
+	cr := c.metrics(&models.Channel{ID: "C1", Name: "support"})
+
+	if cr.Threads != 3 || cr.Answered != 2 || cr.Unanswered != 1 {
+		t.Errorf("expected 3 threads, 2 answered, got %d threads, %d answered, %d unanswered", cr.Threads, cr.Answered, cr.Unanswered)
+	}
+
+	if expected := (Durations{Count: 2, Median: 60, P90: 600, Mean: 330}); cr.FirstReply != expected {
+		t.Errorf("expected first reply %+v, got %+v", expected, cr.FirstReply)
+	}
+
+	if expected := (Durations{Count: 2, Median: 300, P90: 600, Mean: 450}); cr.LastReply != expected {
+		t.Errorf("expected last reply %+v, got %+v", expected, cr.LastReply)
+	}
+
+	expected := []ResponderMetrics{
+		{User: "U3", Threads: 2, Replies: 2, MedianResponse: 120},
+		{User: "U2", Threads: 1, Replies: 2, MedianResponse: 60},
+	}
+
+	if !reflect.DeepEqual(cr.Responders, expected) {
+		t.Errorf("expected responders %+v, got %+v", expected, cr.Responders)
+	}
+
+	if thread := cr.threads[0]; thread.Replies != 3 || thread.FirstResponder != "U2" || *thread.FirstReply != 60 || *thread.LastReply != 300 {
+		t.Errorf("unexpected thread %+v", thread)
+	}
+
+	c = newThreadCollector(from, to, true)
+	for i := range messages {
+		c.add(&messages[i])
+	}
+
+	if cr := c.metrics(&models.Channel{ID: "C1"}); cr.Threads != 2 || cr.Unanswered != 0 {
+		t.Errorf("expected 2 threads, all answered, got %d threads, %d unanswered", cr.Threads, cr.Unanswered)
+	}
+}
+
+func TestWriteResponsivenessCSV(t *testing.T) {
+	first, last := 60.4, 300.0
+
+	cr := &ChannelResponsiveness{
+		Channel:    "C1",
+		Name:       "support",
+		Threads:    2,
+		Answered:   1,
+		Unanswered: 1,
+		FirstReply: Durations{Count: 1, Median: 60.4, P90: 60.4, Mean: 60.4},
+		LastReply:  Durations{Count: 1, Median: 300, P90: 300, Mean: 300},
+		Responders: []ResponderMetrics{
+			{User: "U2", Threads: 1, Replies: 2, MedianResponse: 60.4},
+		},
+		threads: []*ThreadMetrics{
+			{Channel: "C1", Timestamp: "1000.000200", User: "U1", Replies: 2, FirstReply: &first, LastReply: &last, FirstResponder: "U2"},
+			{Channel: "C1", Timestamp: "1100.000100", User: "U4"},
+		},
+	}
+
+	tests := []struct {
+		report   string
+		expected string
+	}{
+		{"channels", "channel,name,threads,answered,unanswered,first_reply_median,first_reply_p90,first_reply_mean,last_reply_median,last_reply_p90,last_reply_mean\n" +
+			"C1,support,2,1,1,60,60,60,300,300,300\n"},
+		{"responders", "channel,user,threads,replies,median_response\n" +
+			"C1,U2,1,2,60\n"},
+		{"threads", "channel,ts,user,replies,first_reply,last_reply,first_responder\n" +
+			"C1,1000.000200,U1,2,60,300,U2\n" +
+			"C1,1100.000100,U4,0,,,\n"},
+	}
+
+	for _, test := range tests {
+		buf := bytes.Buffer{}
+		if err := writeResponsivenessCSV(csv.NewWriter(&buf), test.report, []*ChannelResponsiveness{cr}); err != nil {
+			t.Errorf("%s: unexpected error %s", test.report, err.Error())
+		} else if buf.String() != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.report, test.expected, buf.String())
+		}
+	}
+}
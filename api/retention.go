@@ -0,0 +1,213 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+
+	config "github.com/dutchcoders/slackarchive/config"
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+// RetentionReport contains the outcome of a single retention run.
+type RetentionReport struct {
+	Started  time.Time                `json:"started"`
+	Finished time.Time                `json:"finished"`
+	DryRun   bool                     `json:"dry_run"`
+	Deleted  int                      `json:"deleted"`
+	Held     int                      `json:"held"`
+	Channels []RetentionChannelReport `json:"channels"`
+}
+
+// RetentionChannelReport contains the outcome of a retention run for a
+// single channel.
+type RetentionChannelReport struct {
+	Team    string `json:"team"`
+	Channel string `json:"channel"`
+	Name    string `json:"name,omitempty"`
+	Days    int    `json:"days"`
+	Before  string `json:"before"`
+	Deleted int    `json:"deleted"`
+	Held    int    `json:"held"`
+	Error   string `json:"error,omitempty"`
+}
+
+func (api *api) retention() {
+	ticker := time.NewTicker(api.config.Retention.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := api.Retention(api.config.Retention.DryRun); err != nil {
+			log.Errorf("Error enforcing retention: %s", err.Error())
+		}
+
+		<-ticker.C
+	}
+}
+
+// Retention deletes all messages that expired according to the configured
+// retention policies from mongo and elasticsearch. With dryRun the expired
+// messages will only be counted. The report will be written to the retention
+// folder in the data directory.
+func (api *api) Retention(dryRun bool) (*RetentionReport, error) {
+	report := RetentionReport{
+		Started:  time.Now(),
+		DryRun:   dryRun,
+		Channels: []RetentionChannelReport{},
+	}
+
+	session := api.session.Copy()
+	defer session.Close()
+
+	db := Database(session)
+
+	for _, policy := range api.config.Retention.Teams {
+		channels := []string{}
+		if err := db.Messages.Find(bson.M{"team": policy.Team}).Distinct("channel", &channels); err != nil {
+			return nil, err
+		}
+
+		holds, err := activeHolds(db, policy.Team)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, channel := range channels {
+			cr := api.retentionChannel(db, policy, holds, channel, report.Started, dryRun)
+
+			report.Deleted += cr.Deleted
+			report.Held += cr.Held
+			report.Channels = append(report.Channels, cr)
+		}
+	}
+
+	report.Finished = time.Now()
+
+	log.Infof("Retention finished: %d messages expired, %d held (dry run: %t).", report.Deleted, report.Held, dryRun)
+
+	if err := api.writeRetentionReport(&report); err != nil {
+		return &report, err
+	}
+
+	return &report, nil
+}
+
+func (api *api) retentionChannel(db *database, policy config.RetentionPolicy, holds models.Holds, channel string, now time.Time, dryRun bool) RetentionChannelReport {
+	cr := RetentionChannelReport{
+		Team:    policy.Team,
+		Channel: channel,
+		Days:    policy.Period(channel),
+	}
+
+	c := models.Channel{}
+	if err := db.Channels.FindId(channel).One(&c); err == nil {
+		cr.Name = c.Name
+	}
+
+	if cr.Days <= 0 {
+		// keep indefinitely
+		return cr
+	}
+
+	cr.Before = strconv.FormatInt(now.AddDate(0, 0, -cr.Days).Unix(), 10)
+
+	iter := db.Messages.Find(bson.M{
+		"team":    policy.Team,
+		"channel": channel,
+		"ts": bson.M{
+			"$lt": cr.Before,
+		},
+	}).Select(bson.M{
+		"_id":     1,
+		"team":    1,
+		"channel": 1,
+		"user":    1,
+		"ts":      1,
+	}).Batch(1000).Iter()
+	defer iter.Close()
+
+	ids := []string{}
+
+	remove := func() error {
+		if len(ids) == 0 {
+			return nil
+		}
+
+		defer func() {
+			ids = ids[:0]
+		}()
+
+		bulk := api.es.Bulk()
+		for _, id := range ids {
+			bulk.Delete(messagesIndex, id)
+		}
+
+		if _, err := bulk.Do(context.Background()); err != nil {
+			return err
+		}
+
+		info, err := db.Messages.RemoveAll(bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+
+		cr.Deleted += info.Removed
+		return nil
+	}
+
+	message := models.Message{}
+	for iter.Next(&message) {
+		if len(holds.Covers(&message)) > 0 {
+			cr.Held++
+			continue
+		}
+
+		if dryRun {
+			cr.Deleted++
+			continue
+		}
+
+		ids = append(ids, message.ID)
+
+		if len(ids) < 1000 {
+			continue
+		}
+
+		if err := remove(); err != nil {
+			cr.Error = err.Error()
+			return cr
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		cr.Error = err.Error()
+	} else if err := remove(); err != nil {
+		cr.Error = err.Error()
+	}
+
+	return cr
+}
+
+func (api *api) writeRetentionReport(report *RetentionReport) error {
+	p := path.Join(api.config.Data, "retention")
+	if err := os.MkdirAll(p, 0750); err != nil {
+		return err
+	}
+
+	f, err := os.Create(path.Join(p, fmt.Sprintf("report-%s.json", report.Started.Format("20060102T150405"))))
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
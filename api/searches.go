@@ -0,0 +1,167 @@
+package api
+
+import (
+	"net/mail"
+	"time"
+
+	mgo "gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+	utils "github.com/dutchcoders/slackarchive/utils"
+)
+
+// savedSearch returns the saved search with id of the signed in user.
+func savedSearch(ctx *Context, id string) (*models.SavedSearch, error) {
+	search := models.SavedSearch{}
+	if err := ctx.db.Searches.Find(bson.M{
+		"_id":  id,
+		"team": ctx.team,
+		"user": ctx.user,
+	}).One(&search); err == mgo.ErrNotFound {
+		return nil, ErrSearchNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &search, nil
+}
+
+func (api *api) searchesHandler(ctx *Context) error {
+	response := struct {
+		Searches []models.SavedSearch `json:"searches"`
+	}{
+		Searches: []models.SavedSearch{},
+	}
+
+	if err := ctx.db.Searches.Find(bson.M{
+		"team": ctx.team,
+		"user": ctx.user,
+	}).Sort("created_at").All(&response.Searches); err != nil {
+		return err
+	}
+
+	return ctx.Write(response)
+}
+
+func (api *api) searchHandler(ctx *Context) error {
+	search, err := savedSearch(ctx, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	return ctx.Write(search)
+}
+
+func (api *api) createSearchHandler(ctx *Context) error {
+	search := models.SavedSearch{}
+	if err := ctx.Read(&search); err != nil {
+		return err
+	}
+
+	verr := &errors.ValidationError{}
+	if search.Name == "" {
+		verr.Add("name", "required", "Name is required")
+	}
+
+	if search.Query == "" {
+		verr.Add("query", "required", "Query is required")
+	} else if sq, err := parseQuery(search.Query); err != nil {
+		verr.Add("query", "invalid", err.Error())
+	} else if _, err := sq.compile(ctx.db, ctx.team); err != nil {
+		verr.Add("query", "invalid", err.Error())
+	}
+
+	if search.Webhook == "" && search.Email == "" {
+		verr.Add("webhook", "required", "Webhook or email is required")
+	}
+
+	if search.Webhook == "" {
+	} else if err := checkWebhook(ctx.r.Context(), search.Webhook); err != nil {
+		verr.Add("webhook", "invalid", err.Error())
+	}
+
+	if search.Email == "" {
+	} else if addr, err := mail.ParseAddress(search.Email); err != nil {
+		verr.Add("email", "invalid", "Email address is invalid")
+	} else if api.config.Alerts.SMTP.Host == "" {
+		verr.Add("email", "unavailable", "Email has not been configured")
+	} else {
+		// the name of the address is not used
+		search.Email = addr.Address
+	}
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	search.ID = utils.NewUUID().String()
+	search.Team = ctx.team
+	search.User = ctx.user
+	search.CreatedAt = time.Now()
+
+	if err := ctx.db.Searches.Insert(&search); err != nil {
+		return err
+	}
+
+	return ctx.Write(search)
+}
+
+func (api *api) deleteSearchHandler(ctx *Context) error {
+	search, err := savedSearch(ctx, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	if err := ctx.db.Searches.RemoveId(search.ID); err != nil {
+		return err
+	}
+
+	_, err = ctx.db.Alerts.RemoveAll(bson.M{"search": search.ID})
+	return err
+}
+
+func (api *api) alertsHandler(ctx *Context) error {
+	response := struct {
+		Alerts     []models.Alert `json:"alerts"`
+		NextCursor string         `json:"next_cursor,omitempty"`
+	}{
+		Alerts: []models.Alert{},
+	}
+
+	search, err := savedSearch(ctx, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	size, err := pageSize(ctx, 100, 1000)
+	if err != nil {
+		return err
+	}
+
+	qry := bson.M{"search": search.ID}
+
+	if cursor := ctx.r.FormValue("cursor"); cursor != "" {
+		createdAt, id, err := decodeTimeCursor(cursor)
+		if err != nil {
+			return err
+		}
+
+		qry["$or"] = []bson.M{
+			bson.M{"created_at": bson.M{"$lt": createdAt}},
+			bson.M{"created_at": createdAt, "_id": bson.M{"$gt": id}},
+		}
+	}
+
+	if err := ctx.db.Alerts.Find(qry).Sort("-created_at", "_id").Limit(size).All(&response.Alerts); err != nil {
+		return err
+	}
+
+	if len(response.Alerts) == size {
+		last := response.Alerts[size-1]
+		response.NextCursor = encodeTimeCursor(last.CreatedAt, last.ID)
+	}
+
+	return ctx.Write(response)
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+
+	"gopkg.in/mgo.v2/bson"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+func (api *api) settingsHandler(ctx *Context) error {
+	settings, err := teamSettings(ctx.db, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	return ctx.Write(settings)
+}
+
+// updateSettingsHandler updates the search settings of a team. Messages of
+// the team are reindexed in the background when the language settings have
+// changed, a changed vocabulary only requires the search analyzers to be
+// updated.
+func (api *api) updateSettingsHandler(ctx *Context) error {
+	if count, err := ctx.db.Teams.FindId(ctx.Vars["id"]).Count(); err != nil {
+		return err
+	} else if count == 0 {
+		return ErrTeamNotFound
+	}
+
+	current, err := teamSettings(ctx.db, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	settings := *current
+	if err := ctx.Read(&settings); err != nil {
+		return err
+	}
+
+	settings.Team = current.Team
+
+	verr := &errors.ValidationError{}
+	if _, ok := analyzers[settings.Language]; settings.Language != "" && !ok {
+		verr.Add("language", "invalid", "Language is not supported")
+	}
+
+	validateVocabulary(&settings, verr)
+
+	if !verr.Valid() {
+		return verr
+	}
+
+	if !reflect.DeepEqual(settings.Synonyms, current.Synonyms) || !reflect.DeepEqual(settings.ProtectedWords, current.ProtectedWords) {
+		// the analyzers are updated first, as elasticsearch validates them
+		if err := api.updateVocabulary(ctx.db, &settings); err == nil {
+		} else if ee, ok := err.(*elastic.Error); ok && ee.Status == http.StatusBadRequest {
+			return errors.New("invalid-vocabulary", ee.Details.Reason, http.StatusBadRequest)
+		} else {
+			return err
+		}
+	}
+
+	if _, err := ctx.db.Settings.UpsertId(settings.Team, &settings); err != nil {
+		return err
+	}
+
+	api.settings.remove(settings.Team)
+
+	if settings.Language != current.Language || settings.DetectLanguage != current.DetectLanguage {
+		go func(team string) {
+			count, err := api.reindex(bson.M{"team": team})
+			if err != nil {
+				log.Errorf("Error reindexing team %s: %s", team, err.Error())
+				return
+			}
+
+			log.Infof("Reindexed %d messages of team %s for new language settings.", count, team)
+		}(settings.Team)
+	}
+
+	return ctx.Write(settings)
+}
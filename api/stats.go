@@ -0,0 +1,321 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// statsTTL is the time workspace statistics are cached.
+const statsTTL = 5 * time.Minute
+
+const (
+	// heatmapScript returns the hour of the week (UTC) a message was posted,
+	// starting on monday. The epoch is on a thursday.
+	heatmapScript = "(((long) (doc['ts.float'].value / 86400) + 3) % 7) * 24 + (long) (doc['ts.float'].value / 3600) % 24"
+
+	// reactionsScript returns the total number of reactions to a message.
+	reactionsScript = "if (!doc.containsKey('reactions.count')) { return 0; } double count = 0; for (def c : doc['reactions.count']) { count += c; } return count;"
+)
+
+// StatsSeries contains the number of messages of a channel or user per
+// interval.
+type StatsSeries struct {
+	Key     string           `json:"key"`
+	Count   int64            `json:"count"`
+	Buckets []TimelineBucket `json:"buckets"`
+}
+
+// ReactedMessage is a message with the total number of reactions to it.
+type ReactedMessage struct {
+	Message   MessageResponse `json:"message"`
+	Reactions int             `json:"reactions"`
+}
+
+// Stats contains the activity of a workspace over a period. The heatmap has
+// the number of messages per weekday, starting on monday, and hour (UTC).
+type Stats struct {
+	Interval string  `json:"interval"`
+	From     float64 `json:"from"`
+	To       float64 `json:"to"`
+	Total    int64   `json:"total"`
+
+	Channels []StatsSeries `json:"channels"`
+	Users    []StatsSeries `json:"users"`
+
+	// Daily is empty for periods with too many days
+	ActiveUsers struct {
+		Daily  []TimelineBucket `json:"daily"`
+		Weekly []TimelineBucket `json:"weekly"`
+	} `json:"active_users"`
+
+	Heatmap    [7][24]int64     `json:"heatmap"`
+	TopReacted []ReactedMessage `json:"top_reacted"`
+
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+type statsEntry struct {
+	stats   *Stats
+	expires time.Time
+}
+
+// statsCache caches statistics per team and parameters for statsTTL.
+type statsCache struct {
+	sync.Mutex
+
+	entries map[string]statsEntry
+}
+
+func (c *statsCache) get(key string) (*Stats, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+
+	return entry.stats, true
+}
+
+func (c *statsCache) put(key string, stats *Stats) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+
+	if c.entries == nil {
+		c.entries = map[string]statsEntry{}
+	}
+
+	for k, entry := range c.entries {
+		if now.After(entry.expires) {
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = statsEntry{
+		stats:   stats,
+		expires: now.Add(statsTTL),
+	}
+}
+
+// series returns the buckets of a terms aggregation with a timeline
+// sub-aggregation.
+func series(agg *elastic.AggregationBucketKeyItems) []StatsSeries {
+	result := []StatsSeries{}
+
+	for _, bucket := range agg.Buckets {
+		s := StatsSeries{
+			Key:     bucket.Key.(string),
+			Count:   bucket.DocCount,
+			Buckets: []TimelineBucket{},
+		}
+
+		if timeline, ok := bucket.Histogram("timeline"); ok {
+			for _, b := range timeline.Buckets {
+				s.Buckets = append(s.Buckets, TimelineBucket{
+					Timestamp: b.Key,
+					Count:     b.DocCount,
+				})
+			}
+		}
+
+		result = append(result, s)
+	}
+
+	return result
+}
+
+// activeUsers returns the number of distinct users per bucket of the
+// histogram.
+func activeUsers(agg *elastic.AggregationBucketHistogramItems) []TimelineBucket {
+	result := []TimelineBucket{}
+
+	for _, bucket := range agg.Buckets {
+		b := TimelineBucket{
+			Timestamp: bucket.Key,
+		}
+
+		if users, ok := bucket.Cardinality("users"); ok && users.Value != nil {
+			b.Count = int64(*users.Value)
+		}
+
+		result = append(result, b)
+	}
+
+	return result
+}
+
+// statsHandler returns the activity of the team between from and to,
+// defaulting to the last 30 days. Statistics are cached for a few minutes.
+func (api *api) statsHandler(ctx *Context) error {
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	key := team.ID + "?" + ctx.r.URL.Query().Encode()
+	if stats, ok := api.stats.get(key); ok {
+		return ctx.Write(stats)
+	}
+
+	stats := Stats{
+		Interval:    "day",
+		To:          float64(time.Now().Unix()),
+		Channels:    []StatsSeries{},
+		Users:       []StatsSeries{},
+		TopReacted:  []ReactedMessage{},
+		GeneratedAt: time.Now(),
+	}
+
+	stats.From = stats.To - 30*24*60*60
+
+	stats.ActiveUsers.Daily = []TimelineBucket{}
+	stats.ActiveUsers.Weekly = []TimelineBucket{}
+
+	if val := ctx.r.FormValue("interval"); val != "" {
+		stats.Interval = val
+	}
+
+	if val, err := strconv.ParseFloat(ctx.r.FormValue("from"), 64); err == nil {
+		stats.From = val
+	}
+
+	if val, err := strconv.ParseFloat(ctx.r.FormValue("to"), 64); err == nil {
+		stats.To = val
+	}
+
+	size := 10
+	if val, err := strconv.Atoi(ctx.r.FormValue("size")); err == nil && val > 0 && val <= 50 {
+		size = val
+	}
+
+	timeline, err := timelineHistogram(stats.Interval)
+	if err != nil {
+		return err
+	}
+
+	if stats.To <= stats.From {
+		return errors.New("invalid-range", "From should be before to", http.StatusBadRequest)
+	} else if (stats.To-stats.From)/intervals[stats.Interval] > maxTimelineBuckets {
+		return errors.New("invalid-range", "Period contains too many intervals, use a larger interval", http.StatusBadRequest)
+	}
+
+	channels, err := visibleChannels(ctx.db, team.ID, ctx.r.FormValue("channel"))
+	if err != nil {
+		return err
+	}
+
+	q := messagesFilter(team.ID).
+		Filter(
+			elastic.NewTermsQuery("channel.raw", channels...),
+			elastic.NewRangeQuery("ts.float").Gte(stats.From).Lt(stats.To),
+		)
+
+	weekly, err := timelineHistogram("week")
+	if err != nil {
+		return err
+	}
+
+	weekly.SubAggregation("users", elastic.NewCardinalityAggregation().Field("user.raw"))
+
+	reacted := elastic.NewTopHitsAggregation().
+		SortBy(elastic.NewScriptSort(elastic.NewScript(reactionsScript), "number").Desc()).
+		Size(size)
+
+	ss := elastic.NewSearchSource().
+		Query(q).
+		Size(0).
+		Aggregation("channels", elastic.NewTermsAggregation().
+			Field("channel.raw").
+			Size(size).
+			OrderByCountDesc().
+			SubAggregation("timeline", timeline)).
+		Aggregation("users", elastic.NewTermsAggregation().
+			Field("user.raw").
+			Size(size).
+			OrderByCountDesc().
+			SubAggregation("timeline", timeline)).
+		Aggregation("weekly", weekly).
+		Aggregation("heatmap", elastic.NewTermsAggregation().
+			Script(elastic.NewScript(heatmapScript)).
+			Size(7*24)).
+		Aggregation("reacted", elastic.NewFilterAggregation().
+			Filter(elastic.NewExistsQuery("reactions.name")).
+			SubAggregation("messages", reacted))
+
+	if (stats.To-stats.From)/intervals["day"] <= maxTimelineBuckets {
+		daily, err := timelineHistogram("day")
+		if err != nil {
+			return err
+		}
+
+		daily.SubAggregation("users", elastic.NewCardinalityAggregation().Field("user.raw"))
+
+		ss = ss.Aggregation("daily", daily)
+	}
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	stats.Total = searchResult.Hits.TotalHits
+
+	if agg, ok := searchResult.Aggregations.Terms("channels"); ok {
+		stats.Channels = series(agg)
+	}
+
+	if agg, ok := searchResult.Aggregations.Terms("users"); ok {
+		stats.Users = series(agg)
+	}
+
+	if agg, ok := searchResult.Aggregations.Histogram("daily"); ok {
+		stats.ActiveUsers.Daily = activeUsers(agg)
+	}
+
+	if agg, ok := searchResult.Aggregations.Histogram("weekly"); ok {
+		stats.ActiveUsers.Weekly = activeUsers(agg)
+	}
+
+	if agg, ok := searchResult.Aggregations.Terms("heatmap"); ok {
+		for _, bucket := range agg.Buckets {
+			if hour, err := bucket.KeyNumber.Int64(); err != nil {
+			} else if hour >= 0 && hour < 7*24 {
+				stats.Heatmap[hour/24][hour%24] = bucket.DocCount
+			}
+		}
+	}
+
+	if agg, ok := searchResult.Aggregations.Filter("reacted"); !ok {
+	} else if messages, ok := agg.TopHits("messages"); ok && messages.Hits != nil {
+		for _, hit := range messages.Hits.Hits {
+			msg, err := messageFromHit(hit)
+			if err != nil {
+				continue
+			}
+
+			reactions := 0
+			for _, reaction := range msg.Reactions {
+				reactions += reaction.Count
+			}
+
+			stats.TopReacted = append(stats.TopReacted, ReactedMessage{
+				Message:   *msg,
+				Reactions: reactions,
+			})
+		}
+	}
+
+	api.stats.put(key, &stats)
+
+	return ctx.Write(&stats)
+}
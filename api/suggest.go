@@ -0,0 +1,77 @@
+package api
+
+import (
+	"strings"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// fuzzyThreshold is the number of hits below which a search is repeated with
+// fuzzy matching.
+const fuzzyThreshold = 3
+
+const spellingSuggester = "spelling"
+
+// spellingCollate only keeps corrections matching messages in the channels
+// of the team visible to the user, so terms from other teams or private
+// channels are never suggested.
+const spellingCollate = `{"bool":{"filter":[` +
+	`{"term":{"team.raw":"{{team}}"}},` +
+	`{"terms":{"channel.raw":{{#toJson}}channels{{/toJson}}}},` +
+	`{"match":{"text":{"query":"{{suggestion}}","operator":"and"}}}` +
+	`]}}`
+
+// Suggestion is a spelling correction of the free text of a search. Query
+// is the corrected search including the modifiers.
+type Suggestion struct {
+	Text  string  `json:"text"`
+	Query string  `json:"query"`
+	Score float64 `json:"score"`
+}
+
+func (sq *searchQuery) suggestText() string {
+	return strings.Replace(strings.Join(sq.Text, " "), `"`, "", -1)
+}
+
+// suggester returns a suggester for corrections of the free text of sq, based
+// on the terms in the messages of team in channels.
+func (sq *searchQuery) suggester(team string, channels []interface{}) elastic.Suggester {
+	generator := elastic.NewDirectCandidateGenerator("text").
+		SuggestMode("always").
+		MinWordLength(3)
+
+	return elastic.NewPhraseSuggester(spellingSuggester).
+		Text(sq.suggestText()).
+		Field("text").
+		Size(3).
+		MaxErrors(2).
+		CandidateGenerator(generator).
+		CollateQuery(spellingCollate).
+		CollateParams(map[string]interface{}{
+			"team":     team,
+			"channels": channels,
+		})
+}
+
+// suggestions returns the corrections in result for the suggester of sq.
+func (sq *searchQuery) suggestions(result *elastic.SearchResult) []Suggestion {
+	suggestions := []Suggestion{}
+
+	text := sq.suggestText()
+
+	for _, suggestion := range result.Suggest[spellingSuggester] {
+		for _, option := range suggestion.Options {
+			if option.Text == text {
+				continue
+			}
+
+			suggestions = append(suggestions, Suggestion{
+				Text:  option.Text,
+				Query: strings.Join(append([]string{option.Text}, sq.Modifiers...), " "),
+				Score: option.Score,
+			})
+		}
+	}
+
+	return suggestions
+}
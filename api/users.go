@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+
+	models "github.com/dutchcoders/slackarchive/models"
+	utils "github.com/dutchcoders/slackarchive/utils"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// hourScript returns the hour of the day (UTC) a message was posted.
+const hourScript = "(long) (doc['ts.float'].value / 3600) % 24"
+
+// HourBucket contains the number of messages posted in an hour of the day.
+type HourBucket struct {
+	Hour  int   `json:"hour"`
+	Count int64 `json:"count"`
+}
+
+// UserActivity summarizes the messages of a user in the channels visible to
+// the caller. FirstSeen and LastSeen are the timestamps of the first and last
+// message, Hours has the number of messages per hour of the day in UTC.
+type UserActivity struct {
+	Messages  int64         `json:"messages"`
+	Channels  []FacetBucket `json:"channels"`
+	FirstSeen float64       `json:"first_seen,omitempty"`
+	LastSeen  float64       `json:"last_seen,omitempty"`
+	Hours     []HourBucket  `json:"hours"`
+}
+
+// teamUser returns the user of team with id.
+func teamUser(db *database, team, id string) (*models.User, error) {
+	user := models.User{}
+	if err := db.Users.Find(bson.M{"_id": id, "team": team}).One(&user); err == mgo.ErrNotFound {
+		return nil, ErrUserNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// userMessagesQuery returns the query for the messages of user in the
+// channels of team that are still being archived.
+func userMessagesQuery(db *database, team, user string) (*elastic.BoolQuery, error) {
+	channels, err := visibleChannels(db, team, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return messagesFilter(team).
+		Filter(
+			elastic.NewTermQuery("user.raw", user),
+			elastic.NewTermsQuery("channel.raw", channels...),
+		), nil
+}
+
+// userHandler returns the profile of a user with their activity.
+func (api *api) userHandler(ctx *Context) error {
+	response := struct {
+		UserResponse
+
+		IsBot    bool         `json:"is_bot"`
+		Activity UserActivity `json:"activity"`
+	}{}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := teamUser(ctx.db, team.ID, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	if err := utils.Merge(&response.UserResponse, *user); err != nil {
+		log.Error(err.Error())
+	}
+
+	response.IsBot = user.IsBot
+
+	q, err := userMessagesQuery(ctx.db, team.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	ss := elastic.NewSearchSource().
+		Query(q).
+		Size(0).
+		Aggregation("channels", elastic.NewTermsAggregation().Field("channel.raw").Size(100).OrderByCountDesc()).
+		Aggregation("first", elastic.NewMinAggregation().Field("ts.float")).
+		Aggregation("last", elastic.NewMaxAggregation().Field("ts.float")).
+		Aggregation("hours", elastic.NewTermsAggregation().Script(elastic.NewScript(hourScript)).Size(24))
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	activity := UserActivity{
+		Messages: searchResult.Hits.TotalHits,
+		Channels: []FacetBucket{},
+		Hours:    make([]HourBucket, 24),
+	}
+
+	if channels, ok := searchResult.Aggregations.Terms("channels"); ok {
+		for _, bucket := range channels.Buckets {
+			activity.Channels = append(activity.Channels, FacetBucket{
+				Key:   bucket.Key.(string),
+				Count: bucket.DocCount,
+			})
+		}
+	}
+
+	if first, ok := searchResult.Aggregations.Min("first"); ok && first.Value != nil {
+		activity.FirstSeen = *first.Value
+	}
+
+	if last, ok := searchResult.Aggregations.Max("last"); ok && last.Value != nil {
+		activity.LastSeen = *last.Value
+	}
+
+	for hour := range activity.Hours {
+		activity.Hours[hour].Hour = hour
+	}
+
+	if hours, ok := searchResult.Aggregations.Terms("hours"); ok {
+		for _, bucket := range hours.Buckets {
+			if hour, err := bucket.KeyNumber.Int64(); err != nil {
+			} else if hour >= 0 && hour < 24 {
+				activity.Hours[hour].Count = bucket.DocCount
+			}
+		}
+	}
+
+	response.Activity = activity
+
+	return ctx.Write(response)
+}
+
+// userMessagesHandler returns the messages of a user in the channels visible
+// to the caller, newest first.
+func (api *api) userMessagesHandler(ctx *Context) error {
+	response := struct {
+		Messages   []MessageResponse `json:"messages"`
+		TotalCount int64             `json:"total"`
+		NextCursor string            `json:"next_cursor,omitempty"`
+	}{
+		Messages: []MessageResponse{},
+	}
+
+	team, err := api.Team(ctx)
+	if err != nil {
+		return err
+	}
+
+	user, err := teamUser(ctx.db, team.ID, ctx.Vars["id"])
+	if err != nil {
+		return err
+	}
+
+	size, err := pageSize(ctx, 50, 500)
+	if err != nil {
+		return err
+	}
+
+	q, err := userMessagesQuery(ctx.db, team.ID, user.ID)
+	if err != nil {
+		return err
+	}
+
+	ss := elastic.NewSearchSource().
+		Query(q).
+		Sort("ts.float", false).
+		Sort("id.raw", false).
+		Size(size)
+
+	if cursor := ctx.r.FormValue("cursor"); cursor == "" {
+	} else if values, err := decodeCursor(cursor, 2); err != nil {
+		return err
+	} else {
+		ss = ss.SearchAfter(values...)
+	}
+
+	searchResult, err := api.es.Search(context.Background(), messagesIndex, ss)
+	if err != nil {
+		return err
+	}
+
+	response.TotalCount = searchResult.Hits.TotalHits
+
+	for _, hit := range searchResult.Hits.Hits {
+		msg, err := messageFromHit(hit)
+		if err != nil {
+			continue
+		}
+
+		response.Messages = append(response.Messages, *msg)
+	}
+
+	if hits := searchResult.Hits.Hits; len(hits) == size {
+		response.NextCursor = encodeCursor(hits[len(hits)-1].Sort...)
+	}
+
+	return ctx.Write(response)
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	errors "github.com/dutchcoders/slackarchive/api/errors"
+	models "github.com/dutchcoders/slackarchive/models"
+)
+
+// searchAnalyzer returns the name of the analyzer applying the vocabulary
+// of team to queries, for the text analyzed for lang if lang is set.
+func searchAnalyzer(team, lang string) string {
+	if lang == "" {
+		return fmt.Sprintf("search_%s", team)
+	}
+
+	return fmt.Sprintf("search_%s_%s", team, lang)
+}
+
+// vocabularyAnalysis returns the analysis settings for the synonyms and
+// protected words of all teams, and the code analyzer.
+func vocabularyAnalysis(db *database) (map[string]interface{}, error) {
+	settings := []models.TeamSettings{}
+	if err := db.Settings.Find(nil).All(&settings); err != nil {
+		return nil, err
+	}
+
+	return analysis(settings), nil
+}
+
+func analysis(settings []models.TeamSettings) map[string]interface{} {
+	filters := map[string]interface{}{}
+	custom := map[string]interface{}{}
+
+	for lang, analyzer := range analyzers {
+		filters["stop_"+lang] = map[string]interface{}{
+			"type":      "stop",
+			"stopwords": fmt.Sprintf("_%s_", analyzer),
+		}
+
+		filters["stemmer_"+lang] = map[string]interface{}{
+			"type":     "stemmer",
+			"language": analyzer,
+		}
+	}
+
+	for _, s := range settings {
+		if !s.HasVocabulary() {
+			continue
+		}
+
+		vocabulary := []string{}
+
+		if len(s.Synonyms) > 0 {
+			name := "synonyms_" + s.Team
+			filters[name] = map[string]interface{}{
+				"type":     "synonym",
+				"synonyms": s.Synonyms,
+			}
+
+			vocabulary = append(vocabulary, name)
+		}
+
+		if len(s.ProtectedWords) > 0 {
+			name := "protected_" + s.Team
+			filters[name] = map[string]interface{}{
+				"type":        "keyword_marker",
+				"keywords":    s.ProtectedWords,
+				"ignore_case": true,
+			}
+
+			vocabulary = append(vocabulary, name)
+		}
+
+		custom[searchAnalyzer(s.Team, "")] = map[string]interface{}{
+			"type":      "custom",
+			"tokenizer": "standard",
+			"filter":    append([]string{"lowercase"}, vocabulary...),
+		}
+
+		for lang := range analyzers {
+			filter := append([]string{"lowercase"}, vocabulary...)
+			filter = append(filter, "stop_"+lang, "stemmer_"+lang)
+
+			custom[searchAnalyzer(s.Team, lang)] = map[string]interface{}{
+				"type":      "custom",
+				"tokenizer": "standard",
+				"filter":    filter,
+			}
+		}
+	}
+
+	codeAnalysis(filters, custom)
+
+	return map[string]interface{}{
+		"filter":   filters,
+		"analyzer": custom,
+	}
+}
+
+// validateVocabulary checks the format of the synonyms and protected words
+// of settings.
+func validateVocabulary(settings *models.TeamSettings, verr *errors.ValidationError) {
+	for _, synonym := range settings.Synonyms {
+		words := strings.FieldsFunc(strings.Replace(synonym, "=>", ",", -1), func(r rune) bool {
+			return r == ','
+		})
+
+		if len(words) < 2 {
+			verr.Add("synonyms", "invalid", fmt.Sprintf("Synonym %q should contain at least two words", synonym))
+		} else if strings.Count(synonym, "=>") > 1 {
+			verr.Add("synonyms", "invalid", fmt.Sprintf("Synonym %q contains more than one mapping", synonym))
+		}
+
+		for _, word := range words {
+			if strings.TrimSpace(word) == "" {
+				verr.Add("synonyms", "invalid", fmt.Sprintf("Synonym %q contains an empty word", synonym))
+				break
+			}
+		}
+	}
+
+	for _, word := range settings.ProtectedWords {
+		if strings.TrimSpace(word) == "" {
+			verr.Add("protected_words", "invalid", "Protected words can't be empty")
+		}
+	}
+}
+
+// updateVocabulary applies the vocabulary of settings, together with the
+// vocabulary of all other teams, to the search index.
+func (api *api) updateVocabulary(db *database, settings *models.TeamSettings) error {
+	all := []models.TeamSettings{*settings}
+
+	others := []models.TeamSettings{}
+	if err := db.Settings.Find(nil).All(&others); err != nil {
+		return err
+	}
+
+	for _, other := range others {
+		if other.Team != settings.Team {
+			all = append(all, other)
+		}
+	}
+
+	return api.es.UpdateAnalysis(context.Background(), messagesIndex, analysis(all))
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"io/ioutil"
+	"time"
 
 	yaml "gopkg.in/yaml.v2"
 
@@ -18,6 +19,10 @@ type Config struct {
 
 	Team string `yaml:"team"`
 
+	Admin struct {
+		Token string `yaml:"token"`
+	} `yaml:"admin"`
+
 	Database struct {
 		DSN string `yaml:"dsn"`
 	} `yaml:"database"`
@@ -35,10 +40,61 @@ type Config struct {
 	Data string `yaml:"data"`
 
 	ElasticSearch struct {
-		URL string `yaml:"url"`
+		URL     string `yaml:"url"`
+		Backend string `yaml:"backend"`
 	} `yaml:"elasticsearch"`
 
 	SessionName string `yaml:"session_name"`
+
+	Encryption struct {
+		Key  string            `yaml:"key"`
+		Keys map[string]string `yaml:"keys"`
+	} `yaml:"encryption"`
+
+	Retention struct {
+		Interval time.Duration     `yaml:"interval"`
+		DryRun   bool              `yaml:"dry_run"`
+		Teams    []RetentionPolicy `yaml:"teams"`
+	} `yaml:"retention"`
+
+	Alerts struct {
+		// Limit is the maximum number of alerts delivered per saved
+		// search within Window.
+		Limit  int           `yaml:"limit"`
+		Window time.Duration `yaml:"window"`
+
+		SMTP struct {
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+			From     string `yaml:"from"`
+		} `yaml:"smtp"`
+	} `yaml:"alerts"`
+
+	Autocomplete struct {
+		// Interval is the interval the names and frequent terms of all
+		// teams are updated.
+		Interval time.Duration `yaml:"interval"`
+	} `yaml:"autocomplete"`
+}
+
+// RetentionPolicy defines the number of days messages of a team are kept,
+// Channels overrides the team default per channel id. A period of 0 days
+// keeps messages indefinitely.
+type RetentionPolicy struct {
+	Team     string         `yaml:"team"`
+	Days     int            `yaml:"days"`
+	Channels map[string]int `yaml:"channels"`
+}
+
+// Period returns the retention period in days for channel.
+func (p RetentionPolicy) Period(channel string) int {
+	if days, ok := p.Channels[channel]; ok {
+		return days
+	}
+
+	return p.Days
 }
 
 func MustLoad(path string) *Config {
@@ -73,6 +129,26 @@ func (c *Config) Load(path string) error {
 		c.Listen = "127.0.0.1:8080"
 	}
 
+	if c.Retention.Interval == 0 {
+		c.Retention.Interval = 24 * time.Hour
+	}
+
+	if c.Alerts.Limit == 0 {
+		c.Alerts.Limit = 10
+	}
+
+	if c.Alerts.Window == 0 {
+		c.Alerts.Window = time.Hour
+	}
+
+	if c.Alerts.SMTP.Port == 0 {
+		c.Alerts.SMTP.Port = 25
+	}
+
+	if c.Autocomplete.Interval == 0 {
+		c.Autocomplete.Interval = 15 * time.Minute
+	}
+
 	err = c.init()
 	return err
 }
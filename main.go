@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"errors"
 	"math/rand"
 	"os"
 	_ "os/exec"
@@ -35,6 +37,68 @@ func main() {
 
 	app.Action = run
 
+	app.Commands = []cli.Command{
+		{
+			Name:  "retention",
+			Usage: "Delete messages that expired according to the retention policies",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "dry-run",
+					Usage: "Only report the messages that would be deleted",
+				},
+			},
+			Action: retention,
+		},
+		{
+			Name:  "backup",
+			Usage: "Write all archived data to a single backup archive",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "out", Usage: "Output file, defaults to stdout"},
+			},
+			Action: backup,
+		},
+		{
+			Name:  "restore",
+			Usage: "Restore a backup archive into an empty instance and rebuild the search index",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "in", Usage: "Backup archive, defaults to stdin"},
+				cli.BoolFlag{Name: "force", Usage: "Restore into a non empty instance"},
+			},
+			Action: restore,
+		},
+		{
+			Name:   "rotate-keys",
+			Usage:  "Encrypt plaintext messages and re-encrypt data keys with the active key",
+			Action: rotateKeys,
+		},
+		{
+			Name:  "gdpr",
+			Usage: "Export or erase all data of a single user",
+			Subcommands: []cli.Command{
+				{
+					Name:  "export",
+					Usage: "Export profile, messages and files of a user",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "user", Usage: "User id"},
+						cli.StringFlag{Name: "actor", Usage: "Name of the person requesting the export"},
+						cli.StringFlag{Name: "out", Usage: "Output file, defaults to stdout"},
+					},
+					Action: exportUser,
+				},
+				{
+					Name:  "erase",
+					Usage: "Pseudonymize the profile and redact the messages of a user",
+					Flags: []cli.Flag{
+						cli.StringFlag{Name: "user", Usage: "User id"},
+						cli.StringFlag{Name: "actor", Usage: "Name of the person requesting the erasure"},
+						cli.StringFlag{Name: "reason", Usage: "Reason of the erasure"},
+					},
+					Action: eraseUser,
+				},
+			},
+		},
+	}
+
 	app.Run(os.Args)
 }
 
@@ -44,3 +108,99 @@ func run(c *cli.Context) {
 	api := slackarchiveapi.New(conf)
 	api.Serve()
 }
+
+func retention(c *cli.Context) error {
+	conf := config.MustLoad(c.GlobalString("config"))
+
+	api := slackarchiveapi.New(conf)
+
+	_, err := api.Retention(c.Bool("dry-run") || conf.Retention.DryRun)
+	return err
+}
+
+func backup(c *cli.Context) error {
+	conf := config.MustLoad(c.GlobalString("config"))
+
+	api := slackarchiveapi.New(conf)
+
+	out := os.Stdout
+	if p := c.String("out"); p != "" {
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		out = f
+	}
+
+	return api.Backup(out)
+}
+
+func restore(c *cli.Context) error {
+	conf := config.MustLoad(c.GlobalString("config"))
+
+	api := slackarchiveapi.New(conf)
+
+	in := os.Stdin
+	if p := c.String("in"); p != "" {
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		in = f
+	}
+
+	return api.Restore(in, c.Bool("force"))
+}
+
+func rotateKeys(c *cli.Context) error {
+	conf := config.MustLoad(c.GlobalString("config"))
+
+	api := slackarchiveapi.New(conf)
+
+	_, err := api.RotateKeys()
+	return err
+}
+
+func exportUser(c *cli.Context) error {
+	if c.String("user") == "" || c.String("actor") == "" {
+		return errors.New("user and actor are required")
+	}
+
+	conf := config.MustLoad(c.GlobalString("config"))
+
+	api := slackarchiveapi.New(conf)
+
+	out := os.Stdout
+	if p := c.String("out"); p != "" {
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+
+		defer f.Close()
+		out = f
+	}
+
+	return api.ExportUser(c.String("user"), c.String("actor"), out)
+}
+
+func eraseUser(c *cli.Context) error {
+	if c.String("user") == "" || c.String("actor") == "" || c.String("reason") == "" {
+		return errors.New("user, actor and reason are required")
+	}
+
+	conf := config.MustLoad(c.GlobalString("config"))
+
+	api := slackarchiveapi.New(conf)
+
+	record, err := api.EraseUser(c.String("user"), c.String("actor"), c.String("reason"))
+	if err != nil {
+		return err
+	}
+
+	return json.NewEncoder(os.Stdout).Encode(record)
+}
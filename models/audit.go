@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// AuditRecord records an administrative action on the archive.
+type AuditRecord struct {
+	ID        string                 `json:"id" bson:"_id"`
+	Action    string                 `json:"action" bson:"action"`
+	Team      string                 `json:"team" bson:"team"`
+	Subject   string                 `json:"subject" bson:"subject"`
+	Actor     string                 `json:"actor" bson:"actor"`
+	Reason    string                 `json:"reason,omitempty" bson:"reason,omitempty"`
+	Details   map[string]interface{} `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt time.Time              `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,81 @@
+package models
+
+import "time"
+
+// Hold is a legal hold, messages within its scope are preserved and will
+// not be expired by retention or erased. A hold without users and channels
+// covers the whole team; with both, messages matching either are covered.
+type Hold struct {
+	ID       string     `json:"id" bson:"_id"`
+	Team     string     `json:"team" bson:"team"`
+	Name     string     `json:"name" bson:"name"`
+	Users    []string   `json:"users,omitempty" bson:"users,omitempty"`
+	Channels []string   `json:"channels,omitempty" bson:"channels,omitempty"`
+	From     *time.Time `json:"from,omitempty" bson:"from,omitempty"`
+	To       *time.Time `json:"to,omitempty" bson:"to,omitempty"`
+
+	Reason    string    `json:"reason" bson:"reason"`
+	CreatedBy string    `json:"created_by" bson:"created_by"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+
+	ReleasedBy string     `json:"released_by,omitempty" bson:"released_by,omitempty"`
+	ReleasedAt *time.Time `json:"released_at,omitempty" bson:"released_at,omitempty"`
+}
+
+// Covers returns true if message is within the scope of the hold.
+func (h *Hold) Covers(message *Message) bool {
+	if h.ReleasedAt != nil {
+		return false
+	}
+
+	if h.Team != message.Team {
+		return false
+	}
+
+	if t := message.Time(); t.IsZero() {
+	} else if h.From != nil && t.Before(*h.From) {
+		return false
+	} else if h.To != nil && !t.Before(*h.To) {
+		return false
+	}
+
+	if len(h.Users) == 0 && len(h.Channels) == 0 {
+		return true
+	}
+
+	return contains(h.Users, message.User) || contains(h.Channels, message.Channel)
+}
+
+// Holds is a set of legal holds.
+type Holds []Hold
+
+// Covers returns the ids of the holds covering message.
+func (holds Holds) Covers(message *Message) []string {
+	ids := []string{}
+	for i := range holds {
+		if holds[i].Covers(message) {
+			ids = append(ids, holds[i].ID)
+		}
+	}
+
+	return ids
+}
+
+// PreservedMessage is a version of a held message, saved before it was
+// changed or deleted.
+type PreservedMessage struct {
+	ID          string    `json:"id" bson:"_id"`
+	Holds       []string  `json:"holds" bson:"holds"`
+	Message     Message   `json:"message" bson:"message"`
+	PreservedAt time.Time `json:"preserved_at" bson:"preserved_at"`
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
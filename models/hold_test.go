@@ -0,0 +1,65 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestHoldCovers(t *testing.T) {
+	day := func(value string) *time.Time {
+		t, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			panic(err)
+		}
+
+		return &t
+	}
+
+	// 2017-01-15
+	message := Message{
+		Team:      "T1",
+		Channel:   "C1",
+		User:      "U1",
+		Timestamp: "1484438400.000100",
+	}
+
+	tests := []struct {
+		name     string
+		hold     Hold
+		expected bool
+	}{
+		{"team", Hold{Team: "T1"}, true},
+		{"other team", Hold{Team: "T2"}, false},
+		{"released", Hold{Team: "T1", ReleasedAt: day("2017-02-01")}, false},
+		{"user", Hold{Team: "T1", Users: []string{"U2", "U1"}}, true},
+		{"other user", Hold{Team: "T1", Users: []string{"U2"}}, false},
+		{"channel", Hold{Team: "T1", Channels: []string{"C1"}}, true},
+		{"user or channel", Hold{Team: "T1", Users: []string{"U2"}, Channels: []string{"C1"}}, true},
+		{"within period", Hold{Team: "T1", From: day("2017-01-01"), To: day("2017-02-01")}, true},
+		{"before period", Hold{Team: "T1", From: day("2017-01-16")}, false},
+		{"after period", Hold{Team: "T1", To: day("2017-01-15")}, false},
+		{"period and user", Hold{Team: "T1", Users: []string{"U2"}, From: day("2017-01-01")}, false},
+	}
+
+	for _, test := range tests {
+		if actual := test.hold.Covers(&message); actual != test.expected {
+			t.Errorf("%s: expected %t, got %t", test.name, test.expected, actual)
+		}
+	}
+
+	// messages without valid timestamp are covered regardless of the period
+	if !(&Hold{Team: "T1", From: day("2017-01-16")}).Covers(&Message{Team: "T1"}) {
+		t.Errorf("expected message without timestamp to be covered")
+	}
+
+	holds := Holds{
+		{ID: "1", Team: "T1", Users: []string{"U1"}},
+		{ID: "2", Team: "T1", Channels: []string{"C2"}},
+		{ID: "3", Team: "T1"},
+	}
+
+	if actual := holds.Covers(&message); !reflect.DeepEqual(actual, []string{"1", "3"}) {
+		t.Errorf("expected holds 1 and 3, got %v", actual)
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
 
 // Msg contains information about a slack message
 type Message struct {
@@ -17,6 +21,7 @@ type Message struct {
 	PinnedTo    []string     `json:"pinned_to,omitempty" bson:"pinned_to,omitempty"`
 	Attachments []Attachment `json:"attachments,omitempty" bson:"attachments,omitempty"`
 	Edited      *Edited      `json:"edited,omitempty" bson:"edited,omitempty"`
+	Reactions   []Reaction   `json:"reactions,omitempty" bson:"reactions,omitempty"`
 
 	// Message Subtypes
 	SubType string `json:"subtype,omitempty" bson:"subtype,omitempty"`
@@ -64,6 +69,30 @@ type Message struct {
 	Team    string `json:"team,omitempty" bson:"team,omitempty"`
 
 	IsDeleted bool `json:"is_deleted,omitempty" bson:"is_deleted,omitempty"`
+
+	// Encrypted contains the sealed content of the message when encryption
+	// at rest is enabled, it is never exposed outside of the database.
+	Encrypted *Envelope `json:"-" bson:"encrypted,omitempty"`
+}
+
+// Envelope contains content encrypted with a data key, the data key itself
+// is encrypted with the key identified by Key.
+type Envelope struct {
+	Key     string `bson:"key"`
+	DataKey []byte `bson:"data_key"`
+	Nonce   []byte `bson:"nonce"`
+	Data    []byte `bson:"data"`
+}
+
+// Time returns the time the message was posted, derived from its timestamp.
+func (m *Message) Time() time.Time {
+	ts, err := strconv.ParseFloat(m.Timestamp, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	sec := int64(ts)
+	return time.Unix(sec, int64((ts-float64(sec))*1e9))
 }
 
 // Icon is used for bot messages
@@ -72,6 +101,13 @@ type Icon struct {
 	IconEmoji string `json:"icon_emoji,omitempty" bson:"icon_emoji,omitempty"`
 }
 
+// Reaction contains the users that reacted with the same emoji.
+type Reaction struct {
+	Name  string   `json:"name,omitempty" bson:"name,omitempty"`
+	Count int      `json:"count,omitempty" bson:"count,omitempty"`
+	Users []string `json:"users,omitempty" bson:"users,omitempty"`
+}
+
 // Edited indicates that a message has been edited.
 type Edited struct {
 	User      string `json:"user,omitempty" bson:"user,omitempty"`
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// SavedSearch is a search query of a user, new messages matching the query
+// are delivered as alerts to the webhook or email address.
+type SavedSearch struct {
+	ID      string `json:"id" bson:"_id"`
+	Team    string `json:"team" bson:"team"`
+	User    string `json:"user" bson:"user"`
+	Name    string `json:"name" bson:"name"`
+	Query   string `json:"query" bson:"query"`
+	Webhook string `json:"webhook,omitempty" bson:"webhook,omitempty"`
+	Email   string `json:"email,omitempty" bson:"email,omitempty"`
+
+	Disabled  bool      `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+const (
+	AlertDelivered   = "delivered"
+	AlertFailed      = "failed"
+	AlertRateLimited = "rate_limited"
+)
+
+// Alert records the messages that matched a saved search, and whether they
+// have been delivered.
+type Alert struct {
+	ID        string    `json:"id" bson:"_id"`
+	Search    string    `json:"search" bson:"search"`
+	Team      string    `json:"team" bson:"team"`
+	User      string    `json:"user" bson:"user"`
+	Messages  []string  `json:"messages" bson:"messages"`
+	Status    string    `json:"status" bson:"status"`
+	Error     string    `json:"error,omitempty" bson:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,23 @@
+package models
+
+// TeamSettings contains the search settings of a team. Messages are indexed
+// with an analyzer for Language, or for the language detected per message
+// if DetectLanguage is set.
+//
+// Synonyms and ProtectedWords are applied to search queries only. Every
+// synonym is a set of equivalent words separated by commas ("k8s,
+// kubernetes"), or a mapping ("k8s => kubernetes"). Protected words are
+// never stemmed.
+type TeamSettings struct {
+	Team           string `json:"team" bson:"_id"`
+	Language       string `json:"language,omitempty" bson:"language,omitempty"`
+	DetectLanguage bool   `json:"detect_language,omitempty" bson:"detect_language,omitempty"`
+
+	Synonyms       []string `json:"synonyms,omitempty" bson:"synonyms,omitempty"`
+	ProtectedWords []string `json:"protected_words,omitempty" bson:"protected_words,omitempty"`
+}
+
+// HasVocabulary returns whether the team has synonyms or protected words.
+func (s *TeamSettings) HasVocabulary() bool {
+	return len(s.Synonyms) > 0 || len(s.ProtectedWords) > 0
+}
@@ -2,36 +2,36 @@ package models
 
 // UserProfile contains all the information details of a given user
 type UserProfile struct {
-	FirstName          string `bson:"first_name"`
-	LastName           string `bson:"last_name"`
-	RealName           string `bson:"real_name"`
-	RealNameNormalized string `bson:"real_name_normalized"`
-	Email              string `bson:"email"`
-	Skype              string `bson:"skype"`
-	Phone              string `bson:"phone"`
-	Image24            string `bson:"image_24"`
-	Image32            string `bson:"image_32"`
-	Image48            string `bson:"image_48"`
-	Image72            string `bson:"image_72"`
-	Image192           string `bson:"image_192"`
-	ImageOriginal      string `bson:"image_original"`
-	Title              string `bson:"title"`
+	FirstName          string `json:"first_name" bson:"first_name"`
+	LastName           string `json:"last_name" bson:"last_name"`
+	RealName           string `json:"real_name" bson:"real_name"`
+	RealNameNormalized string `json:"real_name_normalized" bson:"real_name_normalized"`
+	Email              string `json:"email" bson:"email"`
+	Skype              string `json:"skype" bson:"skype"`
+	Phone              string `json:"phone" bson:"phone"`
+	Image24            string `json:"image_24" bson:"image_24"`
+	Image32            string `json:"image_32" bson:"image_32"`
+	Image48            string `json:"image_48" bson:"image_48"`
+	Image72            string `json:"image_72" bson:"image_72"`
+	Image192           string `json:"image_192" bson:"image_192"`
+	ImageOriginal      string `json:"image_original" bson:"image_original"`
+	Title              string `json:"title" bson:"title"`
 }
 
 // User contains all the information of a user
 type User struct {
-	ID                string      `bson:"_id"`
-	Name              string      `bson:"name"`
-	Team              string      `bson:"team"`
-	Deleted           bool        `bson:"deleted"`
-	Color             string      `bson:"color"`
-	Profile           UserProfile `bson:"profile"`
-	IsBot             bool        `bson:"is_bot"`
-	IsAdmin           bool        `bson:"is_admin"`
-	IsOwner           bool        `bson:"is_owner"`
-	IsPrimaryOwner    bool        `bson:"is_primary_owner"`
-	IsRestricted      bool        `bson:"is_restricted"`
-	IsUltraRestricted bool        `bson:"is_ultra_restricted"`
-	HasFiles          bool        `bson:"has_files"`
-	Presence          string      `bson:"presence"`
+	ID                string      `json:"id" bson:"_id"`
+	Name              string      `json:"name" bson:"name"`
+	Team              string      `json:"team" bson:"team"`
+	Deleted           bool        `json:"deleted" bson:"deleted"`
+	Color             string      `json:"color" bson:"color"`
+	Profile           UserProfile `json:"profile" bson:"profile"`
+	IsBot             bool        `json:"is_bot" bson:"is_bot"`
+	IsAdmin           bool        `json:"is_admin" bson:"is_admin"`
+	IsOwner           bool        `json:"is_owner" bson:"is_owner"`
+	IsPrimaryOwner    bool        `json:"is_primary_owner" bson:"is_primary_owner"`
+	IsRestricted      bool        `json:"is_restricted" bson:"is_restricted"`
+	IsUltraRestricted bool        `json:"is_ultra_restricted" bson:"is_ultra_restricted"`
+	HasFiles          bool        `json:"has_files" bson:"has_files"`
+	Presence          string      `json:"presence" bson:"presence"`
 }
@@ -0,0 +1,12 @@
+package models
+
+// UserGroup is a group of users that can be mentioned as a whole, e.g.
+// @oncall. Users contains the ids of the members.
+type UserGroup struct {
+	ID          string   `json:"id" bson:"_id"`
+	Team        string   `json:"team_id" bson:"team"`
+	Name        string   `json:"name" bson:"name"`
+	Handle      string   `json:"handle" bson:"handle"`
+	Description string   `json:"description" bson:"description"`
+	Users       []string `json:"users" bson:"users"`
+}
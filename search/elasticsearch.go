@@ -0,0 +1,261 @@
+package search
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// elasticsearch talks to the REST api of Elasticsearch 7 and later and
+// OpenSearch directly, which no longer use mapping types.
+type elasticsearch struct {
+	url    string
+	client *http.Client
+}
+
+// NewElasticsearch returns a backend for Elasticsearch 7 and later and
+// OpenSearch. Credentials can be passed as part of the url.
+func NewElasticsearch(u string) (Backend, error) {
+	if _, err := url.Parse(u); err != nil {
+		return nil, err
+	}
+
+	return &elasticsearch{
+		url: strings.TrimSuffix(u, "/"),
+		client: &http.Client{
+			Timeout: 60 * time.Second,
+		},
+	}, nil
+}
+
+func (es *elasticsearch) do(ctx context.Context, method, path string, params url.Values, contentType string, body io.Reader, v interface{}) error {
+	u := es.url + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return err
+	}
+
+	req = req.WithContext(ctx)
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := es.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		// error responses have the same format as Elasticsearch 5
+		e := &elastic.Error{Status: resp.StatusCode}
+		if err := json.NewDecoder(resp.Body).Decode(e); err != nil || e.Details == nil {
+			e.Details = &elastic.ErrorDetails{
+				Type:   "http_error",
+				Reason: http.StatusText(resp.StatusCode),
+			}
+		}
+
+		return e
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (es *elasticsearch) doJSON(ctx context.Context, method, path string, params url.Values, body interface{}, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+
+		r = bytes.NewReader(data)
+	}
+
+	return es.do(ctx, method, path, params, "application/json", r, v)
+}
+
+func (es *elasticsearch) EnsureIndex(ctx context.Context, index string, settings, mapping map[string]interface{}) error {
+	err := es.doJSON(ctx, "HEAD", fmt.Sprintf("/%s", url.PathEscape(index)), nil, nil, nil)
+	if e, ok := err.(*elastic.Error); ok && e.Status == http.StatusNotFound {
+		return es.doJSON(ctx, "PUT", fmt.Sprintf("/%s", url.PathEscape(index)), nil, map[string]interface{}{
+			"settings": settings,
+			"mappings": mapping,
+		}, nil)
+	} else if err != nil {
+		return err
+	}
+
+	return es.doJSON(ctx, "PUT", fmt.Sprintf("/%s/_mapping", url.PathEscape(index)), nil, mapping, nil)
+}
+
+func (es *elasticsearch) UpdateAnalysis(ctx context.Context, index string, analysis map[string]interface{}) (err error) {
+	if err := es.doJSON(ctx, "POST", fmt.Sprintf("/%s/_close", url.PathEscape(index)), nil, nil, nil); err != nil {
+		return err
+	}
+
+	defer func() {
+		if oerr := es.doJSON(ctx, "POST", fmt.Sprintf("/%s/_open", url.PathEscape(index)), nil, nil, nil); err == nil {
+			err = oerr
+		}
+	}()
+
+	return es.doJSON(ctx, "PUT", fmt.Sprintf("/%s/_settings", url.PathEscape(index)), nil, map[string]interface{}{
+		"analysis": analysis,
+	}, nil)
+}
+
+func (es *elasticsearch) Index(ctx context.Context, index, id string, doc interface{}) error {
+	return es.doJSON(ctx, "PUT", fmt.Sprintf("/%s/_doc/%s", url.PathEscape(index), url.PathEscape(id)), nil, doc, nil)
+}
+
+func (es *elasticsearch) Delete(ctx context.Context, index, id string) error {
+	return es.doJSON(ctx, "DELETE", fmt.Sprintf("/%s/_doc/%s", url.PathEscape(index), url.PathEscape(id)), nil, nil, nil)
+}
+
+func (es *elasticsearch) DeleteByQuery(ctx context.Context, index string, query elastic.Query) (int64, error) {
+	src, err := query.Source()
+	if err != nil {
+		return 0, err
+	}
+
+	params := url.Values{}
+	params.Set("conflicts", "proceed")
+
+	response := struct {
+		Deleted int64 `json:"deleted"`
+	}{}
+
+	if err := es.doJSON(ctx, "POST", fmt.Sprintf("/%s/_delete_by_query", url.PathEscape(index)), params, map[string]interface{}{
+		"query": src,
+	}, &response); err != nil {
+		return 0, err
+	}
+
+	return response.Deleted, nil
+}
+
+func (es *elasticsearch) Refresh(ctx context.Context, index string) error {
+	return es.doJSON(ctx, "POST", fmt.Sprintf("/%s/_refresh", url.PathEscape(index)), nil, nil, nil)
+}
+
+func (es *elasticsearch) Search(ctx context.Context, index string, source *elastic.SearchSource) (*elastic.SearchResult, error) {
+	src, err := source.Source()
+	if err != nil {
+		return nil, err
+	}
+
+	if body, ok := src.(map[string]interface{}); ok {
+		// count all hits instead of the first 10.000 only
+		body["track_total_hits"] = true
+	}
+
+	params := url.Values{}
+	params.Set("rest_total_hits_as_int", "true")
+
+	result := elastic.SearchResult{}
+	if err := es.doJSON(ctx, "POST", fmt.Sprintf("/%s/_search", url.PathEscape(index)), params, src, &result); err != nil {
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (es *elasticsearch) Bulk() Bulk {
+	return &elasticsearchBulk{
+		es: es,
+	}
+}
+
+type elasticsearchBulk struct {
+	es      *elasticsearch
+	actions int
+	body    bytes.Buffer
+}
+
+type bulkAction struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// add appends the action for doc to the body. The lines are encoded before
+// they are written, an action whose document can't be encoded is left out
+// so the body never contains partial actions.
+func (b *elasticsearchBulk) add(action string, index, id string, doc interface{}) {
+	lines := []interface{}{
+		map[string]bulkAction{
+			action: bulkAction{
+				Index: index,
+				ID:    id,
+			},
+		},
+	}
+
+	if doc != nil {
+		lines = append(lines, doc)
+	}
+
+	data := []byte{}
+	for _, line := range lines {
+		encoded, err := json.Marshal(line)
+		if err != nil {
+			log.Errorf("Skipping bulk %s of %s/%s: %s", action, index, id, err.Error())
+			return
+		}
+
+		data = append(append(data, encoded...), '\n')
+	}
+
+	b.body.Write(data)
+	b.actions++
+}
+
+func (b *elasticsearchBulk) Index(index, id string, doc interface{}) Bulk {
+	b.add("index", index, id, doc)
+	return b
+}
+
+func (b *elasticsearchBulk) Delete(index, id string) Bulk {
+	b.add("delete", index, id, nil)
+	return b
+}
+
+func (b *elasticsearchBulk) NumberOfActions() int {
+	return b.actions
+}
+
+func (b *elasticsearchBulk) Do(ctx context.Context) (int, error) {
+	if b.actions == 0 {
+		return 0, fmt.Errorf("No bulk actions to commit")
+	}
+
+	response := elastic.BulkResponse{}
+	if err := b.es.do(ctx, "POST", "/_bulk", nil, "application/x-ndjson", bytes.NewReader(b.body.Bytes()), &response); err != nil {
+		return 0, err
+	}
+
+	// like Elasticsearch 5, the actions are cleared on success only
+	b.body.Reset()
+	b.actions = 0
+
+	return succeeded(&response), nil
+}
@@ -0,0 +1,174 @@
+package search
+
+import (
+	"context"
+
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+// documentType is the mapping type all documents are indexed with.
+const documentType = "message"
+
+type elasticsearch5 struct {
+	client *elastic.Client
+}
+
+// NewElasticsearch5 returns a backend for Elasticsearch 5.
+func NewElasticsearch5(url string) (Backend, error) {
+	client, err := elastic.NewClient(elastic.SetURL(url), elastic.SetSniff(true))
+	if err != nil {
+		return nil, err
+	}
+
+	return &elasticsearch5{
+		client: client,
+	}, nil
+}
+
+func (es *elasticsearch5) EnsureIndex(ctx context.Context, index string, settings, mapping map[string]interface{}) error {
+	exists, err := es.client.IndexExists(index).Do(ctx)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		_, err = es.client.CreateIndex(index).
+			BodyJson(map[string]interface{}{
+				"settings": settings,
+				"mappings": map[string]interface{}{
+					documentType: mapping,
+				},
+			}).
+			Do(ctx)
+		return err
+	}
+
+	_, err = es.client.PutMapping().
+		Index(index).
+		Type(documentType).
+		BodyJson(mapping).
+		Do(ctx)
+	return err
+}
+
+func (es *elasticsearch5) UpdateAnalysis(ctx context.Context, index string, analysis map[string]interface{}) (err error) {
+	if _, err := es.client.CloseIndex(index).Do(ctx); err != nil {
+		return err
+	}
+
+	defer func() {
+		if _, oerr := es.client.OpenIndex(index).Do(ctx); err == nil {
+			err = oerr
+		}
+	}()
+
+	_, err = es.client.IndexPutSettings(index).
+		BodyJson(map[string]interface{}{
+			"analysis": analysis,
+		}).
+		Do(ctx)
+	return err
+}
+
+func (es *elasticsearch5) Index(ctx context.Context, index, id string, doc interface{}) error {
+	_, err := es.client.Index().
+		Index(index).
+		Type(documentType).
+		Id(id).
+		BodyJson(doc).
+		Do(ctx)
+	return err
+}
+
+func (es *elasticsearch5) Delete(ctx context.Context, index, id string) error {
+	_, err := es.client.Delete().
+		Index(index).
+		Type(documentType).
+		Id(id).
+		Do(ctx)
+	return err
+}
+
+func (es *elasticsearch5) DeleteByQuery(ctx context.Context, index string, query elastic.Query) (int64, error) {
+	response, err := es.client.DeleteByQuery(index).
+		Type(documentType).
+		Query(query).
+		ProceedOnVersionConflict().
+		Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return response.Deleted, nil
+}
+
+func (es *elasticsearch5) Refresh(ctx context.Context, index string) error {
+	_, err := es.client.Refresh(index).Do(ctx)
+	return err
+}
+
+func (es *elasticsearch5) Search(ctx context.Context, index string, source *elastic.SearchSource) (*elastic.SearchResult, error) {
+	return es.client.Search().
+		Index(index).
+		Type(documentType).
+		SearchSource(source).
+		Do(ctx)
+}
+
+func (es *elasticsearch5) Bulk() Bulk {
+	return &elasticsearch5Bulk{
+		bulk: es.client.Bulk(),
+	}
+}
+
+type elasticsearch5Bulk struct {
+	bulk *elastic.BulkService
+}
+
+func (b *elasticsearch5Bulk) Index(index, id string, doc interface{}) Bulk {
+	b.bulk = b.bulk.Add(elastic.NewBulkIndexRequest().
+		Index(index).
+		Type(documentType).
+		Id(id).
+		Doc(doc),
+	)
+
+	return b
+}
+
+func (b *elasticsearch5Bulk) Delete(index, id string) Bulk {
+	b.bulk = b.bulk.Add(elastic.NewBulkDeleteRequest().
+		Index(index).
+		Type(documentType).
+		Id(id),
+	)
+
+	return b
+}
+
+func (b *elasticsearch5Bulk) NumberOfActions() int {
+	return b.bulk.NumberOfActions()
+}
+
+func (b *elasticsearch5Bulk) Do(ctx context.Context) (int, error) {
+	response, err := b.bulk.Do(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return succeeded(response), nil
+}
+
+// succeeded returns the number of succeeded actions of a bulk response.
+func succeeded(response *elastic.BulkResponse) int {
+	count := 0
+	for _, item := range response.Items {
+		for _, result := range item {
+			if result.Status >= 200 && result.Status <= 299 {
+				count++
+			}
+		}
+	}
+
+	return count
+}
@@ -0,0 +1,26 @@
+package search
+
+import (
+	"testing"
+)
+
+func TestElasticsearchBulkAdd(t *testing.T) {
+	b := &elasticsearchBulk{}
+
+	b.Index("messages", "1", map[string]interface{}{"text": "hello"})
+	b.Index("messages", "2", map[string]interface{}{"text": make(chan int)})
+	b.Delete("messages", "3")
+
+	expected := `{"index":{"_index":"messages","_id":"1"}}
+{"text":"hello"}
+{"delete":{"_index":"messages","_id":"3"}}
+`
+
+	if b.NumberOfActions() != 2 {
+		t.Errorf("expected 2 actions, got %d", b.NumberOfActions())
+	}
+
+	if body := b.body.String(); body != expected {
+		t.Errorf("expected body %q, got %q", expected, body)
+	}
+}
@@ -0,0 +1,80 @@
+// Package search contains the search backends messages are indexed into.
+//
+// Queries, aggregations, highlighting and sorting are expressed with the
+// builders of elastic.v5, these only generate the query DSL, which is shared
+// by all supported versions of Elasticsearch and OpenSearch. Results are
+// decoded into the elastic.v5 result types.
+package search
+
+import (
+	"context"
+	"fmt"
+
+	logging "github.com/op/go-logging"
+	elastic "gopkg.in/olivere/elastic.v5"
+)
+
+var log = logging.MustGetLogger("slackarchive-search")
+
+const (
+	// BackendElasticsearch5 uses Elasticsearch 5, which requires mapping types.
+	BackendElasticsearch5 = "elasticsearch5"
+
+	// BackendElasticsearch uses Elasticsearch 7 and later or OpenSearch,
+	// which have removed mapping types.
+	BackendElasticsearch = "elasticsearch"
+)
+
+// Backend is a search engine documents can be indexed into and searched.
+type Backend interface {
+	// EnsureIndex creates index with settings and mapping, or adds the
+	// fields of mapping to the existing index.
+	EnsureIndex(ctx context.Context, index string, settings, mapping map[string]interface{}) error
+
+	// UpdateAnalysis replaces the analyzers and filters in analysis. The
+	// index is closed during the update.
+	UpdateAnalysis(ctx context.Context, index string, analysis map[string]interface{}) error
+
+	// Index adds or replaces the document with id.
+	Index(ctx context.Context, index, id string, doc interface{}) error
+
+	// Delete removes the document with id.
+	Delete(ctx context.Context, index, id string) error
+
+	// DeleteByQuery removes the documents matching query and returns the
+	// number of deleted documents.
+	DeleteByQuery(ctx context.Context, index string, query elastic.Query) (int64, error)
+
+	// Bulk returns a new bulk request.
+	Bulk() Bulk
+
+	// Refresh makes all indexed documents available for search.
+	Refresh(ctx context.Context, index string) error
+
+	// Search executes the search source against index.
+	Search(ctx context.Context, index string, source *elastic.SearchSource) (*elastic.SearchResult, error)
+}
+
+// Bulk collects index and delete actions to be executed in a single request.
+type Bulk interface {
+	Index(index, id string, doc interface{}) Bulk
+	Delete(index, id string) Bulk
+
+	NumberOfActions() int
+
+	// Do executes all actions and returns the number of succeeded actions.
+	// The bulk request can be reused afterwards.
+	Do(ctx context.Context) (int, error)
+}
+
+// New returns the backend configured by name.
+func New(backend string, url string) (Backend, error) {
+	switch backend {
+	case "", BackendElasticsearch5:
+		return NewElasticsearch5(url)
+	case BackendElasticsearch:
+		return NewElasticsearch(url)
+	default:
+		return nil, fmt.Errorf("Unknown search backend %s", backend)
+	}
+}